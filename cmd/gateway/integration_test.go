@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/breaker"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/maintenance"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/middleware"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/proxy"
+)
+
+// TestGatewayProxiesToBackend exercises the full middleware chain in front
+// of a fake agent backend.
+func TestGatewayProxiesToBackend(t *testing.T) {
+	var gotRequestID string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRequestID = r.Header.Get("X-Request-ID")
+		w.Write([]byte("agent says hi"))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Environment:             "test",
+		RequestTimeout:          5 * time.Second,
+		RateLimitRequests:       600,
+		RateLimitBurst:          100,
+		CircuitBreakerThreshold: 5,
+		CircuitBreakerTimeout:   time.Second,
+		Services: map[string]*config.ServiceConfig{
+			"agent": {Name: "agent", URL: backend.URL},
+		},
+	}
+
+	cb := breaker.New(cfg.CircuitBreakerThreshold, cfg.CircuitBreakerTimeout)
+	limiter := middleware.NewRateLimiter(cfg.RateLimitRequests, cfg.RateLimitBurst)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/agent/", proxy.ProxyHandler(cfg.Services["agent"], cb, cfg, nil))
+
+	handler := middleware.RecoveryMiddleware(cfg)(
+		middleware.LoggingMiddleware(cfg)(
+			middleware.AuthMiddleware(cfg)(
+				middleware.RateLimitMiddleware(cfg, limiter)(mux))))
+
+	gw := httptest.NewServer(handler)
+	defer gw.Close()
+
+	resp, err := http.Get(gw.URL + "/api/agent/chat")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "agent says hi" {
+		t.Fatalf("got body %q", body)
+	}
+	if gotRequestID == "" {
+		t.Fatal("backend did not receive X-Request-ID")
+	}
+	if resp.Header.Get("X-Request-ID") == "" {
+		t.Fatal("response missing X-Request-ID")
+	}
+}
+
+// signIntegrationJWT mints an HS256 token for end-to-end requests.
+func signIntegrationJWT(t *testing.T, secret string, claims map[string]interface{}) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	body := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// TestRealRouterTopology drives the exact handler production runs — built by
+// newRouter — covering the admin-route auth boundary and an authenticated
+// API request in one pass.
+func TestRealRouterTopology(t *testing.T) {
+	var backendUser string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendUser = r.Header.Get("X-User-ID")
+		w.Write([]byte("agent says hi"))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Environment:             "test",
+		RequestTimeout:          5 * time.Second,
+		RateLimitRequests:       600,
+		RateLimitBurst:          100,
+		CircuitBreakerThreshold: 5,
+		CircuitBreakerTimeout:   time.Second,
+		SupabaseJWTSecret:       "integration-secret",
+		AdminAPIKey:             "integration-admin",
+		PublicPaths:             []string{"/health", "/ready", "/startup"},
+		Services: map[string]*config.ServiceConfig{
+			"agent": {Name: "agent", URL: backend.URL},
+		},
+	}
+
+	rt := newRouter(cfg)
+	defer rt.Close()
+	gw := httptest.NewServer(rt.Handler)
+	defer gw.Close()
+
+	// Management routes reject requests without the admin key...
+	resp, err := http.Get(gw.URL + "/gateway/circuit-breaker/state")
+	if err != nil {
+		t.Fatalf("admin request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated /gateway: got %d, want 401", resp.StatusCode)
+	}
+
+	// ...and serve breaker state with it.
+	req, _ := http.NewRequest(http.MethodGet, gw.URL+"/gateway/circuit-breaker/state", nil)
+	req.Header.Set("X-Admin-Key", "integration-admin")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("admin request failed: %v", err)
+	}
+	var states map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&states); err != nil {
+		t.Fatalf("decoding breaker state: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("authenticated /gateway: got %d, want 200", resp.StatusCode)
+	}
+	if _, ok := states["agent"]; !ok {
+		t.Fatalf("breaker state missing agent: %v", states)
+	}
+
+	// The /api subrouter verifies JWTs: a bad token is rejected...
+	req, _ = http.NewRequest(http.MethodGet, gw.URL+"/api/agent/chat", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("api request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("invalid token: got %d, want 401", resp.StatusCode)
+	}
+
+	// ...and a valid one reaches the backend with its subject as identity.
+	token := signIntegrationJWT(t, "integration-secret", map[string]interface{}{
+		"sub": "user-77",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	req, _ = http.NewRequest(http.MethodGet, gw.URL+"/api/agent/chat", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("api request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "agent says hi" {
+		t.Fatalf("authenticated api request: status %d body %q", resp.StatusCode, body)
+	}
+	if backendUser != "user-77" {
+		t.Fatalf("backend saw X-User-ID %q, want user-77", backendUser)
+	}
+
+	// Health probes stay public through the real chain.
+	resp, err = http.Get(gw.URL + "/health")
+	if err != nil {
+		t.Fatalf("health request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/health: got %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestNewListenerUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "gateway.sock")
+	cfg := &config.Config{UnixSocket: sock}
+	ln, err := newListener(cfg)
+	if err != nil {
+		t.Fatalf("newListener: %v", err)
+	}
+	defer ln.Close()
+
+	if ln.Addr().Network() != "unix" {
+		t.Fatalf("listener network = %q, want unix", ln.Addr().Network())
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatalf("dialing the socket: %v", err)
+	}
+	conn.Close()
+
+	// A stale socket file from an unclean exit must not block the bind.
+	ln.Close()
+	if err := os.WriteFile(sock, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ln, err = newListener(cfg)
+	if err != nil {
+		t.Fatalf("newListener over a stale socket file: %v", err)
+	}
+	ln.Close()
+}
+
+func TestNewListenerTCPBindAddress(t *testing.T) {
+	cfg := &config.Config{BindAddress: "127.0.0.1", Port: "0"}
+	ln, err := newListener(cfg)
+	if err != nil {
+		t.Fatalf("newListener: %v", err)
+	}
+	defer ln.Close()
+	host, _, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil || host != "127.0.0.1" {
+		t.Errorf("listener bound to %q, want 127.0.0.1", ln.Addr())
+	}
+}
+
+func TestMaintenanceToggleEndpoint(t *testing.T) {
+	cfg := &config.Config{
+		Services: map[string]*config.ServiceConfig{
+			"llm": {Name: "llm", URL: "http://llm.internal"},
+		},
+	}
+	handler := maintenanceHandler(maintenance.NewRegistry(), cfg)
+
+	toggle := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/gateway/maintenance?"+query, nil))
+		return rec
+	}
+
+	if rec := toggle("service=llm&enabled=true"); rec.Code != http.StatusOK {
+		t.Fatalf("enabling maintenance: got %d, want 200", rec.Code)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/gateway/maintenance", nil))
+	var state map[string]bool
+	if err := json.NewDecoder(rec.Body).Decode(&state); err != nil {
+		t.Fatalf("decoding state: %v", err)
+	}
+	if !state["llm"] {
+		t.Fatalf("state = %v, want llm in maintenance", state)
+	}
+
+	if rec := toggle("service=llm&enabled=false"); rec.Code != http.StatusOK {
+		t.Fatalf("disabling maintenance: got %d, want 200", rec.Code)
+	}
+	if rec := toggle("service=nope&enabled=true"); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown service: got %d, want 404", rec.Code)
+	}
+	if rec := toggle("service=llm&enabled=sideways"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad enabled value: got %d, want 400", rec.Code)
+	}
+}
+
+// TestMetricsEndpointReportsSizeHistograms pushes a known-size request
+// through the real router and scrapes /gateway/metrics for the histogram.
+func TestMetricsEndpointReportsSizeHistograms(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write(make([]byte, 600))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Environment:             "test",
+		RequestTimeout:          5 * time.Second,
+		RateLimitRequests:       600,
+		RateLimitBurst:          100,
+		CircuitBreakerThreshold: 5,
+		CircuitBreakerTimeout:   time.Second,
+		AdminAPIKey:             "metrics-admin",
+		MetricsLogInterval:      time.Hour,
+		MetricsSizeBuckets:      []int64{256, 1024},
+		Services: map[string]*config.ServiceConfig{
+			"agent": {Name: "agent", URL: backend.URL},
+		},
+	}
+	rt := newRouter(cfg)
+	defer rt.Close()
+	gw := httptest.NewServer(rt.Handler)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/api/agent/chat", "application/octet-stream",
+		bytes.NewReader(make([]byte, 512)))
+	if err != nil {
+		t.Fatalf("api request failed: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, gw.URL+"/gateway/metrics", nil)
+	req.Header.Set("X-Admin-Key", "metrics-admin")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("scrape failed: %v", err)
+	}
+	var metrics map[string]map[string]struct {
+		Buckets map[string]int64 `json:"buckets"`
+		Sum     int64            `json:"sum"`
+		Count   int64            `json:"count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		t.Fatalf("decoding metrics: %v", err)
+	}
+	resp.Body.Close()
+
+	reqHist := metrics["gateway_request_size_bytes"]["agent"]
+	if reqHist.Buckets["1024"] != 1 || reqHist.Count != 1 {
+		t.Fatalf("512-byte request not in the <=1024 bucket: %+v", reqHist)
+	}
+	respHist := metrics["gateway_response_size_bytes"]["agent"]
+	if respHist.Buckets["1024"] != 1 {
+		t.Fatalf("600-byte response not in the <=1024 bucket: %+v", respHist)
+	}
+}
+
+// TestStreamingSurvivesFullChain drives an SSE stream, a connection
+// upgrade, and per-service deadline overrides through the production
+// middleware stack. Every writer wrapper in the chain has to forward
+// Flush, Hijack, and Unwrap for these to reach the connection.
+func TestStreamingSurvivesFullChain(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/ws"):
+			conn, bufrw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("backend hijack: %v", err)
+				return
+			}
+			defer conn.Close()
+			bufrw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+			bufrw.Flush()
+			line, err := bufrw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			bufrw.WriteString("echo: " + line)
+			bufrw.Flush()
+		default:
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, "data: one\n\n")
+			w.(http.Flusher).Flush()
+			<-release
+			io.WriteString(w, "data: two\n\n")
+		}
+	}))
+	defer backend.Close()
+
+	var logBuf bytes.Buffer
+	prevLog := log.Writer()
+	log.SetOutput(&logBuf)
+	t.Cleanup(func() { log.SetOutput(prevLog) })
+
+	cfg := &config.Config{
+		Environment:             "test",
+		RequestTimeout:          5 * time.Second,
+		RateLimitRequests:       600,
+		RateLimitBurst:          100,
+		CircuitBreakerThreshold: 5,
+		CircuitBreakerTimeout:   time.Second,
+		SecurityHeaders:         map[string]string{"X-Content-Type-Options": "nosniff"},
+		Services: map[string]*config.ServiceConfig{
+			"agent": {
+				Name:          "agent",
+				URL:           backend.URL,
+				ReadDeadline:  time.Minute,
+				WriteDeadline: time.Minute,
+			},
+		},
+	}
+	rt := newRouter(cfg)
+	defer rt.Close()
+	gw := httptest.NewServer(rt.Handler)
+	defer gw.Close()
+
+	// A flush must push the first event to the client while the backend
+	// handler is still running; a wrapper that swallows Flush buffers it
+	// until the stream ends.
+	resp, err := http.Get(gw.URL + "/api/agent/stream")
+	if err != nil {
+		t.Fatalf("stream request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatal("security headers missing from streamed response")
+	}
+	events := bufio.NewReader(resp.Body)
+	first := make(chan string, 1)
+	go func() {
+		line, _ := events.ReadString('\n')
+		first <- line
+	}()
+	select {
+	case line := <-first:
+		if line != "data: one\n" {
+			t.Fatalf("first event = %q, want %q", line, "data: one\n")
+		}
+		close(release)
+	case <-time.After(2 * time.Second):
+		close(release)
+		t.Fatal("first SSE event did not arrive while the handler was running; a wrapper swallowed Flush")
+	}
+	io.Copy(io.Discard, events)
+	resp.Body.Close()
+
+	// The per-service deadline overrides go through http.ResponseController,
+	// which needs Unwrap on every wrapper to reach the connection.
+	if logs := logBuf.String(); strings.Contains(logs, "setting read deadline") ||
+		strings.Contains(logs, "setting write deadline") {
+		t.Fatalf("ResponseController could not reach the connection:\n%s", logs)
+	}
+
+	// An upgrade hijacks the connection through the same chain, and the
+	// drain registry must see the taken-over connection.
+	conn, err := net.Dial("tcp", gw.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dialing gateway: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "GET /api/agent/ws HTTP/1.1\r\nHost: gateway\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	br := bufio.NewReader(conn)
+	upgrade, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("reading upgrade response: %v", err)
+	}
+	if upgrade.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade: got %d, want 101", upgrade.StatusCode)
+	}
+	if got := rt.Drain.Active(); got != 1 {
+		t.Fatalf("drain registry tracks %d connections, want the upgraded one", got)
+	}
+	fmt.Fprint(conn, "ping\n")
+	if reply, err := br.ReadString('\n'); err != nil || reply != "echo: ping\n" {
+		t.Fatalf("echo over upgraded connection: %q, %v", reply, err)
+	}
+}
@@ -0,0 +1,239 @@
+// Command gateway runs the Xynenyx API gateway: a reverse proxy in front of
+// the agent, rag, and llm services adding auth, rate limiting, and circuit
+// breaking at the edge.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/breaker"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/maintenance"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/metrics"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/middleware"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/netlimit"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/version"
+)
+
+func main() {
+	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	rt := newRouter(cfg)
+	defer rt.Close()
+
+	ln, err := newListener(cfg)
+	if err != nil {
+		log.Fatalf("listen: %v", err)
+	}
+	if cfg.MaxConnections > 0 {
+		limited := netlimit.Limit(ln, cfg.MaxConnections)
+		rt.ConnCount = limited.Active
+		ln = limited
+	}
+
+	srv := &http.Server{
+		Handler:     rt.Handler,
+		ReadTimeout: 15 * time.Second,
+		// Sized from the longest per-service timeout so a slow-but-allowed
+		// backend response is not cut off by the server itself.
+		WriteTimeout: cfg.MaxRequestTimeout() + 5*time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	go func() {
+		log.Printf("gateway %s listening on %s (env=%s)", version.String(), ln.Addr(), cfg.Environment)
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	// Everything the gateway needs is wired; let the startup probe pass.
+	rt.StartupGate.MarkReady()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	log.Println("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("graceful shutdown failed: %v", err)
+	}
+	// Hijacked connections (WebSockets, takeovers) are invisible to
+	// srv.Shutdown; give them a grace period, then close what remains.
+	if n := rt.Drain.Shutdown(cfg.ShutdownDrainGrace); n > 0 {
+		log.Printf("force-closed %d long-lived connections after drain grace", n)
+	}
+}
+
+// newListener opens the gateway's listener: a Unix domain socket when
+// UNIX_SOCKET is set (removing a stale socket file first), otherwise TCP on
+// BIND_ADDRESS:PORT.
+func newListener(cfg *config.Config) (net.Listener, error) {
+	if cfg.UnixSocket != "" {
+		// A socket file left over from an unclean exit would make the bind
+		// fail even though nothing is listening.
+		if err := os.Remove(cfg.UnixSocket); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", cfg.UnixSocket)
+	}
+	return net.Listen("tcp", cfg.ListenAddr())
+}
+
+// newBreakers builds one circuit breaker per backend service.
+func newBreakers(cfg *config.Config) map[string]*breaker.CircuitBreaker {
+	breakers := make(map[string]*breaker.CircuitBreaker, len(cfg.Services))
+	for _, name := range cfg.ServiceNames() {
+		cb := breaker.New(cfg.CircuitBreakerThreshold, cfg.CircuitBreakerTimeout)
+		if cfg.CircuitBreakerBackoffMultiplier > 1 {
+			cb.SetBackoff(cfg.CircuitBreakerBackoffMultiplier, cfg.CircuitBreakerMaxTimeout)
+		}
+		if cfg.CBJitterPercent > 0 {
+			cb.SetJitter(float64(cfg.CBJitterPercent) / 100)
+		}
+		breakers[name] = cb
+	}
+	return breakers
+}
+
+// connectionsHandler reports the listener's connection cap state. The
+// counter is installed by main after the listener is wrapped, so it is read
+// per request rather than captured at wiring time.
+func connectionsHandler(rt *router, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if rt.ConnCount == nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"enabled": false})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"enabled":         true,
+			"active":          rt.ConnCount(),
+			"max_connections": cfg.MaxConnections,
+		})
+	}
+}
+
+// bulkheadStateHandler reports the bulkhead's in-flight count and queue
+// depth for operational visibility.
+func bulkheadStateHandler(b *middleware.Bulkhead) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if b == nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"enabled": false})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"enabled":     true,
+			"in_flight":   b.InFlight(),
+			"queue_depth": b.QueueDepth(),
+		})
+	}
+}
+
+// configHandler reports the loaded configuration with secrets redacted, so
+// on-call can confirm what a running gateway actually uses.
+func configHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cfg.Redacted())
+	}
+}
+
+// metricsHandler serves the collector's size histograms for scraping; the
+// collector only exists when METRICS_LOG_INTERVAL enables collection.
+func metricsHandler(c *metrics.Collector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if c == nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"enabled": false})
+			return
+		}
+		json.NewEncoder(w).Encode(c.SizeSnapshot())
+	}
+}
+
+// maintenanceHandler reports (GET) and toggles (POST ?service=&enabled=)
+// per-service maintenance mode, so a backend can be drained for a deploy
+// without taking the gateway down.
+func maintenanceHandler(reg *maintenance.Registry, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(reg.Snapshot())
+		case http.MethodPost:
+			name := r.URL.Query().Get("service")
+			if _, ok := cfg.Services[name]; !ok {
+				http.Error(w, "unknown service", http.StatusNotFound)
+				return
+			}
+			enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+			if err != nil {
+				http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+				return
+			}
+			reg.Set(name, enabled)
+			log.Printf("maintenance mode for %s set to %t", name, enabled)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"service": name, "enabled": enabled})
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// breakerStateHandler reports each service breaker's state and failure count.
+func breakerStateHandler(breakers map[string]*breaker.CircuitBreaker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		states := make(map[string]interface{}, len(breakers))
+		for name, cb := range breakers {
+			states[name] = map[string]interface{}{
+				"state":    cb.State().String(),
+				"failures": cb.Failures(),
+				"cooldown": cb.Cooldown().String(),
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(states)
+	}
+}
+
+// breakerResetHandler resets one service's breaker (?service=) or all.
+func breakerResetHandler(breakers map[string]*breaker.CircuitBreaker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := r.URL.Query().Get("service")
+		if name != "" {
+			cb, ok := breakers[name]
+			if !ok {
+				http.Error(w, "unknown service", http.StatusNotFound)
+				return
+			}
+			cb.Reset()
+		} else {
+			for _, cb := range breakers {
+				cb.Reset()
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "reset"})
+	}
+}
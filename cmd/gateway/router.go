@@ -0,0 +1,171 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/breaker"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/drain"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/health"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/liveness"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/maintenance"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/metrics"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/middleware"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/proxy"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/quota"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/transport"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/version"
+)
+
+// router is the fully assembled gateway: the handler plus the pieces the
+// process (and the integration tests) need to reach after assembly.
+type router struct {
+	Handler     http.Handler
+	Breakers    map[string]*breaker.CircuitBreaker
+	StartupGate *health.StartupGate
+	Drain       *drain.Registry
+
+	// ConnCount reports the number of connections currently served; main
+	// installs it when MAX_CONNECTIONS wraps the listener.
+	ConnCount func() int
+
+	closers []func()
+}
+
+// Close releases router-owned resources (the metrics reporter, the access
+// log file).
+func (rt *router) Close() {
+	for _, fn := range rt.closers {
+		fn()
+	}
+}
+
+// newRouter assembles the gateway's complete handler topology — health and
+// admin routes, the service proxies, and the full middleware chain — exactly
+// as production serves it. main wraps the result in an http.Server; the
+// integration tests hit it directly so they exercise the real wiring.
+func newRouter(cfg *config.Config) *router {
+	breakers := newBreakers(cfg)
+	limiter := middleware.NewRateLimiter(cfg.RateLimitRequests, cfg.RateLimitBurst)
+	limiter.SetAnonLimits(cfg.AnonRateLimitRequests, cfg.AnonRateLimitBurst)
+	limiter.SetWriteLimits(cfg.RateLimitWriteRequests, cfg.RateLimitWriteBurst)
+	upstreamTransport := transport.New(cfg)
+	healthClient := &http.Client{Transport: upstreamTransport, Timeout: 2 * time.Second}
+
+	rt := &router{
+		Breakers:    breakers,
+		StartupGate: &health.StartupGate{},
+		Drain:       drain.NewRegistry(),
+	}
+
+	var bulkhead *middleware.Bulkhead
+	if cfg.MaxConcurrentRequests > 0 {
+		bulkhead = middleware.NewBulkhead(cfg.MaxConcurrentRequests)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", health.HealthHandler(liveness.Default))
+	mux.HandleFunc("/startup", health.StartupHandler(rt.StartupGate))
+	// External dependency checkers (a Redis rate-limit store, when one
+	// lands) are registered here so /ready gates on them too.
+	mux.HandleFunc("/ready", health.ReadyHandler(cfg, breakers, healthClient))
+	gatewayMux := http.NewServeMux()
+	gatewayMux.HandleFunc("/gateway/circuit-breaker/state", breakerStateHandler(breakers))
+	gatewayMux.HandleFunc("/gateway/circuit-breaker/reset", breakerResetHandler(breakers))
+	gatewayMux.HandleFunc("/gateway/bulkhead", bulkheadStateHandler(bulkhead))
+	gatewayMux.HandleFunc("/gateway/connections", connectionsHandler(rt, cfg))
+	gatewayMux.HandleFunc("/gateway/config", configHandler(cfg))
+	gatewayMux.HandleFunc("/gateway/version", version.Handler())
+	gatewayMux.HandleFunc("/gateway/maintenance", maintenanceHandler(maintenance.Default, cfg))
+	var collector *metrics.Collector
+	if cfg.MetricsLogInterval > 0 {
+		collector = metrics.NewCollector()
+		collector.SetSizeBuckets(cfg.MetricsSizeBuckets)
+	}
+	gatewayMux.HandleFunc("/gateway/metrics", metricsHandler(collector))
+	var debugCapture *middleware.DebugCapture
+	if cfg.DebugSampleRate > 0 {
+		debugCapture = middleware.NewDebugCapture(cfg.DebugSampleRate, cfg.DebugBufferSize)
+		gatewayMux.HandleFunc("/gateway/debug/requests", debugCapture.Handler())
+	}
+	mux.Handle("/gateway/", middleware.AdminAuthMiddleware(cfg)(gatewayMux))
+
+	registry := proxy.NewRegistry(cfg, upstreamTransport)
+	for _, name := range cfg.ServiceNames() {
+		if svc, ok := cfg.Services[name]; ok {
+			registry.Register(svc, breakers[name])
+		}
+	}
+	mux.Handle("/api/", registry)
+
+	var routes http.Handler = mux
+	if cfg.CacheTTL > 0 {
+		cache := middleware.NewResponseCache(cfg.CacheMaxEntries, cfg.CacheTTL)
+		routes = middleware.CacheMiddleware(cfg, cache)(routes)
+	}
+	if cfg.IdempotencyTTL > 0 {
+		idem := middleware.NewIdempotencyStore(cfg.IdempotencyTTL)
+		routes = middleware.IdempotencyMiddleware(cfg, idem)(routes)
+	}
+	apiChain := middleware.RateLimitMiddleware(cfg, limiter)(routes)
+	if collector != nil {
+		reporter := metrics.NewReporter(collector, cfg.MetricsLogInterval, func() map[string]string {
+			states := make(map[string]string, len(breakers))
+			for name, cb := range breakers {
+				states[name] = cb.State().String()
+			}
+			return states
+		})
+		reporter.Start()
+		rt.closers = append(rt.closers, reporter.Stop)
+		apiChain = middleware.MetricsMiddleware(collector)(apiChain)
+	}
+	if len(cfg.APIKeyConcurrency) > 0 {
+		concurrency := middleware.NewConcurrencyLimiter(cfg.APIKeyConcurrency)
+		apiChain = middleware.ConcurrencyLimitMiddleware(cfg, concurrency)(apiChain)
+	}
+	if cfg.QuotaLimit > 0 {
+		tracker := quota.NewTracker(quota.NewMemoryStore(), cfg.QuotaLimit, cfg.QuotaPeriod)
+		apiChain = middleware.QuotaMiddleware(tracker)(apiChain)
+	}
+	if bulkhead != nil {
+		apiChain = middleware.BulkheadMiddleware(cfg, bulkhead)(apiChain)
+	}
+	if cfg.CompressionMinBytes > 0 {
+		apiChain = middleware.CompressionMiddleware(cfg)(apiChain)
+	}
+	if debugCapture != nil {
+		apiChain = middleware.DebugCaptureMiddleware(cfg, debugCapture)(apiChain)
+	}
+	if cfg.DebugBodyLogging {
+		apiChain = middleware.BodyLogMiddleware(cfg)(apiChain)
+	}
+	if len(cfg.PathDenylist) > 0 || len(cfg.PathAllowlist) > 0 {
+		apiChain = middleware.PathFilterMiddleware(cfg)(apiChain)
+	}
+	apiChain = middleware.ConnDrainMiddleware(rt.Drain)(apiChain)
+	logging := middleware.LoggingMiddleware(cfg)
+	if cfg.AccessLogFile != "" {
+		accessLog, err := middleware.NewRotatingWriter(
+			cfg.AccessLogFile, int64(cfg.AccessLogMaxSizeMB)*1024*1024, cfg.AccessLogMaxBackups)
+		if err != nil {
+			log.Fatalf("opening access log: %v", err)
+		}
+		rt.closers = append(rt.closers, func() { accessLog.Close() })
+		logging = middleware.LoggingMiddlewareTo(cfg, accessLog)
+	}
+	var inner http.Handler = middleware.AuthMiddleware(cfg)(apiChain)
+	if cfg.PathNormalize != "" && cfg.PathNormalize != config.PathNormalizeOff {
+		// Normalize before auth so public-path and rate-limit checks see
+		// the same path the proxy will.
+		inner = middleware.PathNormalizeMiddleware(cfg)(inner)
+	}
+	rt.Handler = middleware.InstanceHeaderMiddleware(cfg)(
+		middleware.RecoveryMiddleware(cfg)(
+			middleware.SecurityHeadersMiddleware(cfg)(
+				logging(
+					middleware.CORSMiddleware(cfg)(inner)))))
+	return rt
+}
@@ -0,0 +1,3 @@
+module github.com/TwoKai-LTD/xynenyx-gateway
+
+go 1.21.6
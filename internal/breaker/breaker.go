@@ -0,0 +1,257 @@
+// Package breaker implements a simple per-service circuit breaker.
+package breaker
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// State is the breaker's current mode.
+type State int
+
+const (
+	// StateClosed lets requests through and counts failures.
+	StateClosed State = iota
+	// StateOpen rejects requests until the cooldown elapses.
+	StateOpen
+	// StateHalfOpen lets a trial request through to probe recovery.
+	StateHalfOpen
+)
+
+// String returns the lower-case state name used in API responses and logs.
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// ErrOpen is returned when the breaker rejects a request in the open state.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker trips open after a run of consecutive failures and probes
+// recovery with a single half-open request once the cooldown has elapsed.
+type CircuitBreaker struct {
+	mu sync.Mutex
+
+	threshold int
+	timeout   time.Duration
+
+	state    State
+	failures int
+
+	// openedAt is when the breaker last transitioned to open; the
+	// open→half-open gate depends only on the state and the elapsed time
+	// since then, so a Reset while open can never leak a retry through a
+	// zero-value timestamp.
+	openedAt time.Time
+
+	// backoffMultiplier, when above 1, grows the cooldown by that factor
+	// for each consecutive open (capped at maxCooldown), easing probe
+	// pressure on a chronically failing backend. opens counts the streak;
+	// it resets once the breaker has stayed closed for a full base
+	// timeout, tracked via closedSince.
+	backoffMultiplier float64
+	maxCooldown       time.Duration
+	opens             int
+	closedSince       time.Time
+
+	// jitterPct spreads each open-state cooldown by ±jitterPct so a fleet
+	// of gateways tripping together doesn't probe the backend in lockstep.
+	// openCooldown is the jittered cooldown drawn for the current open
+	// period; rng is seeded per breaker when jitter is enabled.
+	jitterPct    float64
+	openCooldown time.Duration
+	rng          *rand.Rand
+}
+
+// New returns a closed breaker that opens after threshold consecutive
+// failures and stays open for timeout before probing.
+func New(threshold int, timeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		timeout:   timeout,
+		state:     StateClosed,
+	}
+}
+
+// SetBackoff enables exponential cooldown growth: each consecutive open
+// multiplies the wait before the next half-open probe by multiplier, up to
+// maxCooldown (zero leaves the growth uncapped). The streak resets after
+// the breaker stays closed for a full base timeout.
+func (cb *CircuitBreaker) SetBackoff(multiplier float64, maxCooldown time.Duration) {
+	cb.mu.Lock()
+	cb.backoffMultiplier = multiplier
+	cb.maxCooldown = maxCooldown
+	cb.mu.Unlock()
+}
+
+// SetJitter spreads each open-state cooldown uniformly within ±pct (0.2 =
+// ±20%), so replicas that tripped together probe the backend at different
+// moments instead of in a thundering herd.
+func (cb *CircuitBreaker) SetJitter(pct float64) {
+	cb.mu.Lock()
+	cb.jitterPct = pct
+	if pct > 0 && cb.rng == nil {
+		cb.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	cb.mu.Unlock()
+}
+
+// jitteredLocked draws this open period's effective cooldown from d ± the
+// configured jitter.
+func (cb *CircuitBreaker) jitteredLocked(d time.Duration) time.Duration {
+	if cb.jitterPct <= 0 || cb.rng == nil {
+		return d
+	}
+	factor := 1 + cb.jitterPct*(2*cb.rng.Float64()-1)
+	return time.Duration(float64(d) * factor)
+}
+
+// currentCooldownLocked is the cooldown governing the present open period:
+// the jittered draw when one was made, else the deterministic ladder value.
+func (cb *CircuitBreaker) currentCooldownLocked() time.Duration {
+	if cb.openCooldown > 0 {
+		return cb.openCooldown
+	}
+	return cb.cooldownLocked()
+}
+
+// cooldownLocked returns the current open-state cooldown, applying the
+// backoff multiplier for repeat opens.
+func (cb *CircuitBreaker) cooldownLocked() time.Duration {
+	d := cb.timeout
+	if cb.backoffMultiplier <= 1 {
+		return d
+	}
+	for i := 1; i < cb.opens; i++ {
+		d = time.Duration(float64(d) * cb.backoffMultiplier)
+		if cb.maxCooldown > 0 && d >= cb.maxCooldown {
+			return cb.maxCooldown
+		}
+	}
+	return d
+}
+
+// Allow reports whether a request may proceed, transitioning open→half-open
+// when the cooldown has elapsed. It returns ErrOpen when the request must be
+// rejected.
+func (cb *CircuitBreaker) Allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.allowLocked()
+}
+
+func (cb *CircuitBreaker) allowLocked() error {
+	if cb.state != StateOpen {
+		return nil
+	}
+	if time.Since(cb.openedAt) >= cb.currentCooldownLocked() {
+		cb.state = StateHalfOpen
+		return nil
+	}
+	return ErrOpen
+}
+
+// Call runs fn under the breaker, recording its outcome.
+func (cb *CircuitBreaker) Call(fn func() error) error {
+	if err := cb.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	if err != nil {
+		cb.RecordFailure()
+		return err
+	}
+	cb.RecordSuccess()
+	return nil
+}
+
+// RecordSuccess notes a successful request, closing the breaker if it was
+// probing.
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.failures = 0
+	if cb.state != StateClosed {
+		cb.closedSince = time.Now()
+	}
+	cb.state = StateClosed
+}
+
+// RecordFailure notes a failed request, opening the breaker once the
+// threshold is reached or immediately if a half-open probe failed.
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.failures++
+	if cb.state == StateHalfOpen || cb.failures >= cb.threshold {
+		// A sustained closed stretch (a full base timeout without opening)
+		// forgives the earlier flapping and restarts the backoff ladder.
+		if cb.state == StateClosed && !cb.closedSince.IsZero() && time.Since(cb.closedSince) >= cb.timeout {
+			cb.opens = 0
+		}
+		cb.opens++
+		cb.state = StateOpen
+		cb.openedAt = time.Now()
+		cb.openCooldown = cb.jitteredLocked(cb.cooldownLocked())
+	}
+}
+
+// Cooldown returns the cooldown governing the breaker's current open
+// period — the backoff ladder value with any jitter applied — for
+// operational visibility.
+func (cb *CircuitBreaker) Cooldown() time.Duration {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.currentCooldownLocked()
+}
+
+// RetryAfter returns how long until an open breaker will admit its next
+// probe, rounded to whole seconds for use in a Retry-After header. The
+// result is clamped to at least one second; for a breaker that is not open
+// it is simply the minimum.
+func (cb *CircuitBreaker) RetryAfter() time.Duration {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	remaining := time.Second
+	if cb.state == StateOpen {
+		remaining = cb.currentCooldownLocked() - time.Since(cb.openedAt)
+	}
+	if remaining < time.Second {
+		return time.Second
+	}
+	return remaining.Round(time.Second)
+}
+
+// State returns the breaker's current state.
+func (cb *CircuitBreaker) State() State {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// Failures returns the current consecutive-failure count.
+func (cb *CircuitBreaker) Failures() int {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.failures
+}
+
+// Reset returns the breaker to a pristine closed state.
+func (cb *CircuitBreaker) Reset() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.state = StateClosed
+	cb.failures = 0
+	cb.openedAt = time.Time{}
+	cb.opens = 0
+	cb.closedSince = time.Time{}
+	cb.openCooldown = 0
+}
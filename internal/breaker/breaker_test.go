@@ -0,0 +1,213 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+// trip drives the breaker to the open state.
+func trip(cb *CircuitBreaker) {
+	for i := 0; i < 5; i++ {
+		cb.RecordFailure()
+	}
+}
+
+func TestOpenBreakerHoldsForCooldown(t *testing.T) {
+	cb := New(5, time.Hour)
+	trip(cb)
+
+	if err := cb.Allow(); err != ErrOpen {
+		t.Fatalf("Allow during cooldown = %v, want ErrOpen", err)
+	}
+	if got := cb.State(); got != StateOpen {
+		t.Fatalf("state = %v, want open", got)
+	}
+}
+
+func TestOpenBreakerProbesAfterCooldown(t *testing.T) {
+	cb := New(5, 20*time.Millisecond)
+	trip(cb)
+
+	time.Sleep(30 * time.Millisecond)
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("Allow after cooldown = %v, want nil", err)
+	}
+	if got := cb.State(); got != StateHalfOpen {
+		t.Fatalf("state = %v, want half-open", got)
+	}
+}
+
+func TestResetWhileOpenIsDeterministic(t *testing.T) {
+	cb := New(5, time.Hour)
+	trip(cb)
+	cb.Reset()
+
+	// Reset closes the breaker outright; requests flow without a half-open
+	// probe phase.
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("Allow after reset = %v, want nil", err)
+	}
+	if got := cb.State(); got != StateClosed {
+		t.Fatalf("state after reset = %v, want closed", got)
+	}
+
+	// A fresh run of failures re-opens with a full cooldown: the zeroed
+	// timestamp from Reset must not let a retry through early.
+	trip(cb)
+	if err := cb.Allow(); err != ErrOpen {
+		t.Fatalf("Allow after re-trip = %v, want ErrOpen", err)
+	}
+}
+
+func TestBackoffGrowsCooldownAcrossOpens(t *testing.T) {
+	cb := New(1, 40*time.Millisecond)
+	cb.SetBackoff(3, time.Second)
+
+	// First open: base cooldown.
+	cb.RecordFailure()
+	time.Sleep(50 * time.Millisecond)
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("first cooldown should have elapsed: %v", err)
+	}
+
+	// Failed probe: second open, cooldown now 3x the base.
+	cb.RecordFailure()
+	time.Sleep(60 * time.Millisecond)
+	if err := cb.Allow(); err == nil {
+		t.Fatal("second cooldown should still be holding at 60ms")
+	}
+	time.Sleep(80 * time.Millisecond)
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("second cooldown should have elapsed by 140ms: %v", err)
+	}
+}
+
+func TestBackoffCapsAtMaxCooldown(t *testing.T) {
+	cb := New(1, 10*time.Millisecond)
+	cb.SetBackoff(10, 30*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		cb.RecordFailure()
+		time.Sleep(40 * time.Millisecond)
+		if err := cb.Allow(); err != nil {
+			t.Fatalf("open %d: cooldown should cap at 30ms: %v", i+1, err)
+		}
+	}
+}
+
+func TestBackoffResetsAfterSustainedClose(t *testing.T) {
+	cb := New(1, 30*time.Millisecond)
+	cb.SetBackoff(5, time.Second)
+
+	// Two consecutive opens push the cooldown to 5x.
+	cb.RecordFailure()
+	time.Sleep(40 * time.Millisecond)
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("probe should be allowed: %v", err)
+	}
+	cb.RecordFailure()
+
+	// Recover and stay closed for more than the base timeout.
+	time.Sleep(160 * time.Millisecond)
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("probe should be allowed: %v", err)
+	}
+	cb.RecordSuccess()
+	time.Sleep(50 * time.Millisecond)
+
+	// The next open starts back at the base cooldown.
+	cb.RecordFailure()
+	time.Sleep(40 * time.Millisecond)
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("cooldown after sustained close should be back at base: %v", err)
+	}
+}
+
+func TestRetryAfterTracksRemainingCooldown(t *testing.T) {
+	cb := New(1, 10*time.Second)
+	if got := cb.RetryAfter(); got != time.Second {
+		t.Errorf("closed breaker RetryAfter = %v, want the 1s minimum", got)
+	}
+
+	cb.RecordFailure()
+	if got := cb.RetryAfter(); got < 9*time.Second || got > 10*time.Second {
+		t.Errorf("freshly opened breaker RetryAfter = %v, want ~10s", got)
+	}
+
+	// Near the end of the cooldown the clamp keeps it at one second.
+	cb = New(1, 20*time.Millisecond)
+	cb.RecordFailure()
+	time.Sleep(15 * time.Millisecond)
+	if got := cb.RetryAfter(); got != time.Second {
+		t.Errorf("nearly elapsed cooldown RetryAfter = %v, want the 1s minimum", got)
+	}
+}
+
+func TestCooldownReflectsBackoffLadder(t *testing.T) {
+	cb := New(1, 10*time.Millisecond)
+	cb.SetBackoff(2, 0)
+
+	if got := cb.Cooldown(); got != 10*time.Millisecond {
+		t.Fatalf("closed breaker Cooldown = %v, want the base timeout", got)
+	}
+
+	// Each failed half-open probe doubles the reported cooldown.
+	cb.RecordFailure()
+	for want := 10 * time.Millisecond; want <= 40*time.Millisecond; want *= 2 {
+		if got := cb.Cooldown(); got != want {
+			t.Fatalf("Cooldown = %v on this rung, want %v", got, want)
+		}
+		time.Sleep(cb.Cooldown() + 5*time.Millisecond)
+		if err := cb.Allow(); err != nil {
+			t.Fatal("expected a half-open probe after the cooldown")
+		}
+		cb.RecordFailure()
+	}
+
+	// Recovery closes the breaker; after a sustained closed stretch the
+	// ladder restarts from the base timeout.
+	time.Sleep(cb.Cooldown() + 5*time.Millisecond)
+	if err := cb.Allow(); err != nil {
+		t.Fatal("expected a half-open probe after the cooldown")
+	}
+	cb.RecordSuccess()
+	time.Sleep(15 * time.Millisecond)
+	cb.RecordFailure()
+	if got := cb.Cooldown(); got != 10*time.Millisecond {
+		t.Errorf("Cooldown = %v after recovery, want the base timeout again", got)
+	}
+}
+
+func TestJitterSpreadsCooldownWithinRange(t *testing.T) {
+	base := 100 * time.Millisecond
+	lo, hi := 80*time.Millisecond, 120*time.Millisecond
+	min, max := hi, lo
+	for i := 0; i < 300; i++ {
+		cb := New(1, base)
+		cb.SetJitter(0.2)
+		cb.RecordFailure()
+		d := cb.Cooldown()
+		if d < lo || d > hi {
+			t.Fatalf("jittered cooldown %v outside [%v, %v]", d, lo, hi)
+		}
+		if d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+	}
+	// Over many samples the draws should actually spread, not collapse to
+	// a single value.
+	if max-min < 10*time.Millisecond {
+		t.Errorf("cooldown spread only %v across 300 samples, want real variation", max-min)
+	}
+}
+
+func TestZeroJitterKeepsDeterministicCooldown(t *testing.T) {
+	cb := New(1, 100*time.Millisecond)
+	cb.RecordFailure()
+	if got := cb.Cooldown(); got != 100*time.Millisecond {
+		t.Errorf("Cooldown = %v without jitter, want exactly the base timeout", got)
+	}
+}
@@ -0,0 +1,957 @@
+// Package config loads gateway configuration from the environment.
+package config
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MinRequestTimeout is the smallest request timeout the gateway will run
+// with; misconfigured tiny values (e.g. "1ms") would 504 every request and
+// trip every breaker, so Load floors them and warns.
+const MinRequestTimeout = 100 * time.Millisecond
+
+// serviceNames lists the backend services the gateway fronts, in the order
+// they are probed by the readiness handler.
+var serviceNames = []string{"agent", "rag", "llm"}
+
+// ServiceConfig holds the per-service settings parsed from <NAME>_* env vars.
+type ServiceConfig struct {
+	// Name is the service identifier, e.g. "agent". Routes are mounted
+	// under "/api/<name>/".
+	Name string
+
+	// URL is the upstream base URL, e.g. "http://localhost:8001". With a
+	// weighted pool it is the first target, kept for single-target callers.
+	URL string
+
+	// Targets is the weighted upstream pool parsed from the service URL
+	// value; "http://v1:8003#90,http://v2:8003#10" sends roughly 10% of
+	// traffic to v2. A plain URL yields a single full-weight target.
+	Targets []WeightedTarget
+
+	// AllowedMethods restricts which HTTP methods the gateway will proxy
+	// to this service. Empty means all methods are allowed.
+	AllowedMethods []string
+
+	// RequestSchemaPath optionally points at a JSON Schema file; JSON
+	// request bodies are validated against it before proxying.
+	RequestSchemaPath string
+
+	// RequestTimeout, when set, overrides the gateway-wide RequestTimeout
+	// for this service (from <NAME>_REQUEST_TIMEOUT), letting a slow
+	// backend like llm run long generations without loosening the budget
+	// for everything else.
+	RequestTimeout time.Duration
+
+	// BreakerProbeTimeout, when set, bounds the half-open trial request
+	// instead of the normal request timeout, so a slow recovery doesn't
+	// hold the half-open state for the full duration.
+	BreakerProbeTimeout time.Duration
+
+	// MaxRequestBodyBytes overrides the gateway-wide body cap for this
+	// service; zero falls back to the global setting.
+	MaxRequestBodyBytes int64
+
+	// LBMode selects how a multi-target pool is balanced: weighted random
+	// (the default) or consistent_hash, which pins each user to a node.
+	LBMode string
+
+	// URLExplicit records whether the service URL came from the
+	// environment rather than the localhost default; strict mode uses it
+	// to refuse to boot against unconfigured backends.
+	URLExplicit bool
+
+	// RewriteCookies rewrites upstream Set-Cookie headers so browsers
+	// accept them on the gateway's public domain: Domain becomes
+	// PUBLIC_DOMAIN and Path is grafted under the service prefix.
+	RewriteCookies bool
+
+	// HealthMethod is the HTTP method used to probe this service's /health
+	// endpoint; HEAD is cheaper for upstreams that support it. Defaults
+	// to GET.
+	HealthMethod string
+
+	// HealthPath is the endpoint probed for readiness; defaults to /health.
+	HealthPath string
+
+	// HealthTimeout, when set, bounds this service's readiness probe
+	// instead of the shared client's timeout.
+	HealthTimeout time.Duration
+
+	// ReadyCacheTTL overrides the gateway-wide readiness cache TTL for
+	// this service, so fast-moving backends can be re-probed more often
+	// than stable ones. Zero falls back to the global setting.
+	ReadyCacheTTL time.Duration
+
+	// PassthroughUpstreamCORS passes the upstream's Access-Control-*
+	// headers through untouched and suppresses the gateway's own CORS
+	// injection for this route, for backends that are themselves the CORS
+	// authority. Default is strip-and-inject.
+	PassthroughUpstreamCORS bool
+
+	// LogRedact suppresses request detail in logs for this service: the
+	// access-log path collapses to /api/<name>/*, the query is never
+	// logged, and DEBUG_BODY_LOGGING skips its bodies entirely. For
+	// services handling sensitive payloads (llm prompts).
+	LogRedact bool
+
+	// BreakerErrorSubstring, when set, counts responses whose body contains
+	// the substring as circuit-breaker failures even on a 2xx status — for
+	// upstreams that report degradation in-band (e.g. 200 with
+	// {"error":"overloaded"}). Only the first few KB are scanned.
+	BreakerErrorSubstring string
+
+	// Protocol selects the proxying mode for this service: plain HTTP
+	// reverse proxying (the default) or ProtocolGRPCWeb, which translates
+	// browser gRPC-Web framing to native gRPC for the upstream.
+	Protocol string
+
+	// ReadDeadline and WriteDeadline, when set, override the server-wide
+	// connection deadlines for this service's requests — long write
+	// deadlines keep streaming llm responses alive without loosening the
+	// global WriteTimeout for everyone.
+	ReadDeadline  time.Duration
+	WriteDeadline time.Duration
+}
+
+// StatusRange is an inclusive range of HTTP status codes; a single code is
+// a range with Lo == Hi.
+type StatusRange struct {
+	Lo, Hi int
+}
+
+// parseStatusRanges parses a comma-separated list of codes and ranges like
+// "500-599,429". Malformed entries are skipped with a log line.
+func parseStatusRanges(raw string) []StatusRange {
+	if raw == "" {
+		return nil
+	}
+	var ranges []StatusRange
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		loN, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			log.Printf("ignoring malformed CIRCUIT_BREAKER_FAILURE_CODES entry %q", part)
+			continue
+		}
+		hiN := loN
+		if isRange {
+			if hiN, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil || hiN < loN {
+				log.Printf("ignoring malformed CIRCUIT_BREAKER_FAILURE_CODES entry %q", part)
+				continue
+			}
+		}
+		ranges = append(ranges, StatusRange{Lo: loN, Hi: hiN})
+	}
+	return ranges
+}
+
+// IsBreakerFailure reports whether a response status counts as a
+// circuit-breaker failure: a match against CIRCUIT_BREAKER_FAILURE_CODES
+// when configured, otherwise any 5xx.
+func (c *Config) IsBreakerFailure(status int) bool {
+	if len(c.BreakerFailureCodes) == 0 {
+		return status >= 500
+	}
+	for _, r := range c.BreakerFailureCodes {
+		if status >= r.Lo && status <= r.Hi {
+			return true
+		}
+	}
+	return false
+}
+
+// PATH_NORMALIZE modes.
+const (
+	PathNormalizeOff      = "off"
+	PathNormalizeRedirect = "redirect"
+	PathNormalizeRewrite  = "rewrite"
+)
+
+// LBModeConsistentHash pins each user to a pool node by hashing their
+// resolved identity.
+const LBModeConsistentHash = "consistent_hash"
+
+// Protocol values for ServiceConfig.Protocol (<NAME>_PROTOCOL).
+const (
+	ProtocolHTTP    = "http"
+	ProtocolGRPCWeb = "grpc-web"
+)
+
+// WeightedTarget is one upstream in a service's pool with its relative
+// traffic share.
+type WeightedTarget struct {
+	URL    string
+	Weight int
+}
+
+// parseWeightedTargets splits a service URL value into its weighted pool.
+// Entries are url or url#weight; missing or invalid weights default to 1.
+func parseWeightedTargets(raw string) []WeightedTarget {
+	var targets []WeightedTarget
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		u, weightStr, hasWeight := strings.Cut(part, "#")
+		weight := 1
+		if hasWeight {
+			if n, err := strconv.Atoi(weightStr); err == nil && n > 0 {
+				weight = n
+			} else {
+				log.Printf("ignoring invalid target weight %q in %q, using 1", weightStr, part)
+			}
+		}
+		targets = append(targets, WeightedTarget{URL: u, Weight: weight})
+	}
+	if len(targets) == 0 {
+		// A value like "," yields no usable entries; fall back to the raw
+		// string as a single target so Load never indexes an empty list
+		// and Validate rejects the URL with a real error.
+		targets = []WeightedTarget{{URL: raw, Weight: 1}}
+	}
+	return targets
+}
+
+// AllowsMethod reports whether the service accepts the given HTTP method.
+// An empty allow-list permits everything.
+func (s *ServiceConfig) AllowsMethod(method string) bool {
+	if len(s.AllowedMethods) == 0 {
+		return true
+	}
+	for _, m := range s.AllowedMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// Config is the gateway's runtime configuration.
+type Config struct {
+	Port        string
+	Environment string
+
+	// BindAddress is the interface the TCP listener binds to; the default
+	// 0.0.0.0 listens on all interfaces, 127.0.0.1 restricts the gateway
+	// to loopback-only deployments.
+	BindAddress string
+
+	// UnixSocket, when set, makes the gateway listen on a Unix domain
+	// socket at this path instead of TCP; BindAddress and Port are ignored.
+	UnixSocket string
+
+	// Services maps service name to its per-service configuration.
+	Services map[string]*ServiceConfig
+
+	SupabaseJWTSecret string
+
+	// AdminAPIKey protects the /gateway/* admin endpoints; empty leaves them
+	// open for local development.
+	AdminAPIKey string
+
+	// RequestIDTrustedOnly makes the gateway honor an inbound X-Request-ID
+	// only when it arrives via a trusted proxy; IDs from external clients
+	// are replaced with a freshly generated one.
+	RequestIDTrustedOnly bool
+
+	// APIKeys maps static API keys to the tenant they authenticate as,
+	// parsed from API_KEYS=key:tenant pairs.
+	APIKeys map[string]string
+
+	// APIKeyConcurrency caps in-flight requests per API-key tenant, parsed
+	// from API_KEY_CONCURRENCY=tenant:limit pairs. Tenants without an entry
+	// are unlimited.
+	APIKeyConcurrency map[string]int
+
+	// ResponseHeaderRewrite maps response header names to replacement
+	// values applied to every proxied response; an empty value deletes the
+	// header. Parsed from RESPONSE_HEADER_REWRITE name=value pairs.
+	ResponseHeaderRewrite map[string]string
+
+	// ForwardClaims maps JWT claim names to the upstream header they are
+	// forwarded as, parsed from FORWARD_CLAIMS=claim:header pairs (e.g.
+	// email:X-User-Email,tenant_id:X-Tenant-ID).
+	ForwardClaims map[string]string
+
+	// RateLimitRequests is the sustained per-user request rate per minute;
+	// RateLimitBurst is the bucket capacity.
+	RateLimitRequests int
+	RateLimitBurst    int
+
+	// RequestTimeout bounds the time spent proxying a single request.
+	RequestTimeout time.Duration
+
+	// CircuitBreakerThreshold is the consecutive-failure count that opens a
+	// breaker; CircuitBreakerTimeout is the open-state cooldown.
+	CircuitBreakerThreshold int
+	CircuitBreakerTimeout   time.Duration
+
+	// CORSOrigins is the list of origins allowed to call the gateway.
+	// Empty allows any origin (development only).
+	CORSOrigins []string
+
+	// MaxRequestBodyBytes caps inbound request bodies gateway-wide; zero
+	// means unlimited. Services can override it individually.
+	MaxRequestBodyBytes int64
+
+	// CompressionMinBytes is the response size above which gzip kicks in
+	// for clients that accept it; zero disables compression.
+	CompressionMinBytes int
+
+	// ConcurrencyRetryAfter is the back-off hint sent with rejections from
+	// the concurrency limiters.
+	ConcurrencyRetryAfter time.Duration
+
+	// DecompressUpstream makes the proxy decompress gzipped upstream
+	// responses for clients that did not ask for gzip.
+	DecompressUpstream bool
+
+	// MaxConcurrentRequests caps in-flight requests gateway-wide (the
+	// bulkhead); zero disables the cap.
+	MaxConcurrentRequests int
+
+	// QueueWaitTimeout is how long a request may queue for a bulkhead slot
+	// before being rejected; zero rejects immediately.
+	QueueWaitTimeout time.Duration
+
+	// MetricsLogInterval is how often the aggregate metrics summary is
+	// flushed to the log; zero disables the reporter.
+	MetricsLogInterval time.Duration
+
+	// CacheTTL is the default lifetime of cached GET responses; zero
+	// disables the response cache. CacheMaxEntries bounds its size.
+	CacheTTL        time.Duration
+	CacheMaxEntries int
+
+	// PublicPaths lists routes that bypass auth and rate limiting. Entries
+	// match exactly, or by prefix when they end in '*' (e.g. /metrics*).
+	PublicPaths []string
+
+	// StrictServiceURLs refuses to start when a required service's URL was
+	// not explicitly configured, instead of silently defaulting to
+	// localhost and 502ing at runtime.
+	StrictServiceURLs bool
+
+	// PublicDomain is the domain clients reach the gateway on, used when
+	// rewriting upstream cookies to survive the proxy hop.
+	PublicDomain string
+
+	// AnonCookieSecure, AnonCookieDomain, and AnonCookieMaxAge shape the
+	// gw_anon session cookie issued under the session-cookie anonymous ID
+	// strategy. A zero max-age makes it a session cookie.
+	AnonCookieSecure bool
+	AnonCookieDomain string
+	AnonCookieMaxAge time.Duration
+
+	// RateLimitSubnetV4 and RateLimitSubnetV6 are prefix lengths that,
+	// when set, aggregate anonymous per-IP rate-limit buckets into subnet
+	// buckets (e.g. 24 and 64), so an abuser rotating through a subnet
+	// shares one bucket. Zero keys on individual IPs.
+	RateLimitSubnetV4 int
+	RateLimitSubnetV6 int
+
+	// AnonymousIDStrategy selects how anonymous callers are identified for
+	// rate limiting: "ip" (the default) keys on the client IP,
+	// "session-cookie" issues and reuses a gateway cookie, and
+	// "header-hash" hashes the User-Agent together with the IP.
+	AnonymousIDStrategy string
+
+	// PanicResponseBody and PanicResponseContentType replace the default
+	// JSON panic envelope with a custom payload; empty keeps the default.
+	PanicResponseBody        string
+	PanicResponseContentType string
+
+	// CBJitterPercent spreads each breaker cooldown by up to ± this many
+	// percent, de-synchronizing half-open probes across gateway replicas.
+	CBJitterPercent int
+
+	// BreakerFailureCodes, when set, defines which response status codes
+	// count as circuit-breaker failures (parsed from
+	// CIRCUIT_BREAKER_FAILURE_CODES, e.g. "500-599,429"). Empty keeps the
+	// default of 5xx only.
+	BreakerFailureCodes []StatusRange
+
+	// CircuitBreakerBackoffMultiplier, when above 1, grows each breaker's
+	// cooldown by that factor per consecutive open, capped at
+	// CircuitBreakerMaxTimeout (zero means uncapped).
+	CircuitBreakerBackoffMultiplier float64
+	CircuitBreakerMaxTimeout        time.Duration
+
+	// ReadyCacheTTL caches each backend's readiness probe result for this
+	// long, so frequent /ready polling doesn't hammer the backends. Zero
+	// probes on every request. Services can override it individually.
+	ReadyCacheTTL time.Duration
+
+	// LogSampleRate is the fraction (0..1) of successful responses that get
+	// an access-log entry; 4xx/5xx and slow requests are always logged.
+	// The default 1 logs everything.
+	LogSampleRate float64
+
+	// LogSlowThresholdMS exempts slow requests from sampling: any request
+	// taking longer is always logged. Zero disables the exemption.
+	LogSlowThresholdMS int
+
+	// AccessLogFile, when set, sends JSON access-log entries to this file
+	// with size-based rotation instead of the standard logger.
+	AccessLogFile string
+
+	// AccessLogMaxSizeMB is the rotation threshold for the access log, and
+	// AccessLogMaxBackups how many rotated files are kept.
+	AccessLogMaxSizeMB  int
+	AccessLogMaxBackups int
+
+	// DebugBodyLogging logs size-capped request/response body snippets for
+	// 5xx responses; DebugBodyMaxBytes caps the snippet length and
+	// DebugBodyRedactFields names JSON fields whose values are masked.
+	DebugBodyLogging      bool
+	DebugBodyMaxBytes     int
+	DebugBodyRedactFields []string
+
+	// IdempotencyTTL is how long a response is replayed for a repeated
+	// Idempotency-Key; zero disables the feature.
+	IdempotencyTTL time.Duration
+
+	// RequestTotalTimeout, when positive, caps the total wall-clock time a
+	// request may spend in the gateway across every proxy attempt. Per-
+	// attempt timeouts (RequestTimeout and the per-service overrides) nest
+	// inside it, so retried attempts share one budget rather than each
+	// getting a fresh one.
+	RequestTotalTimeout time.Duration
+
+	// PathNormalize selects the trailing-slash and duplicate-slash policy:
+	// PathNormalizeOff proxies paths verbatim, PathNormalizeRedirect 308s
+	// clients to the canonical form, PathNormalizeRewrite silently proxies
+	// the canonical form.
+	PathNormalize string
+
+	// MetricsSizeBuckets overrides the request/response size histogram
+	// bucket bounds (bytes); empty uses the metrics package defaults.
+	MetricsSizeBuckets []int64
+
+	// PathDenylist and PathAllowlist are glob patterns filtering which /api
+	// paths the gateway will proxy at all: denied paths (and, when an
+	// allowlist is set, paths outside it) are refused with a 403 before any
+	// forwarding decision.
+	PathDenylist  []string
+	PathAllowlist []string
+
+	// InstanceID identifies this gateway replica in the X-Gateway-Instance
+	// response header; empty falls back to the hostname.
+	InstanceID string
+
+	// MaintenanceMessage is the error text served while a service is in
+	// maintenance mode; MaintenanceRetryAfter is the Retry-After hint sent
+	// with it.
+	MaintenanceMessage    string
+	MaintenanceRetryAfter time.Duration
+
+	// MaxConnections, when positive, caps how many client connections the
+	// listener will serve at once; connections past the cap are closed
+	// immediately instead of queueing.
+	MaxConnections int
+
+	// ShutdownDrainGrace is how long shutdown waits for hijacked and
+	// streaming connections to finish before force-closing them.
+	ShutdownDrainGrace time.Duration
+
+	// DebugSampleRate is the fraction (0..1) of requests captured into the
+	// in-memory debug ring buffer; zero disables capture.
+	// DebugBufferSize bounds the buffer.
+	DebugSampleRate float64
+	DebugBufferSize int
+
+	// GatewayDurationHeader adds an X-Gateway-Duration-Ms header reporting
+	// the gateway's processing time on each response.
+	GatewayDurationHeader bool
+
+	// RejectIdentityConflict turns a disagreement between a verified JWT
+	// and an inbound X-User-ID header into a 401 instead of just logging
+	// it and trusting the JWT.
+	RejectIdentityConflict bool
+
+	// AnonRateLimitRequests and AnonRateLimitBurst, when set, give
+	// anonymous callers their own (typically lower) rate-limit parameters;
+	// zero falls back to the standard limits.
+	AnonRateLimitRequests int
+	AnonRateLimitBurst    int
+
+	// RateLimitWriteRequests and RateLimitWriteBurst, when set, give
+	// mutating methods (POST/PUT/PATCH/DELETE) a separate, stricter
+	// budget; reads keep the standard limits.
+	RateLimitWriteRequests int
+	RateLimitWriteBurst    int
+
+	// SchemaMaxBodyBytes caps how much of a request body is buffered for
+	// JSON Schema validation; larger bodies skip validation.
+	SchemaMaxBodyBytes int64
+
+	// LogFields, when set, allow-lists which access-log fields are
+	// emitted; empty emits every field.
+	LogFields []string
+
+	// QuotaLimit is the hard per-user, per-service request allowance per
+	// QuotaPeriod; 0 disables quota enforcement.
+	QuotaLimit  int64
+	QuotaPeriod time.Duration
+
+	// ResetCBOnHealthy restores the old behavior of resetting a service's
+	// circuit breaker whenever a readiness probe finds it healthy. Off by
+	// default: a probe shouldn't mask real failures by closing a breaker
+	// that opened under load.
+	ResetCBOnHealthy bool
+
+	// RequiredServices names the services whose health gates readiness.
+	// Empty means every service is required.
+	RequiredServices []string
+
+	// SecurityHeaders are set on every response; SecurityHeadersOverride
+	// makes them clobber upstream-set values.
+	SecurityHeaders         map[string]string
+	SecurityHeadersOverride bool
+
+	// TrustedProxies are the CIDRs of proxies in front of the gateway
+	// whose forwarded headers (X-Forwarded-For, X-Real-IP) may be trusted.
+	TrustedProxies []*net.IPNet
+
+	// MaxIdleConns, MaxIdleConnsPerHost, and IdleConnTimeout tune the
+	// shared upstream connection pool.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+}
+
+// Load builds a Config from the environment, applying defaults for anything
+// unset.
+func Load() *Config {
+	cfg := &Config{
+		Port:                            getEnv("PORT", "8080"),
+		Environment:                     getEnv("ENVIRONMENT", "development"),
+		BindAddress:                     getEnv("BIND_ADDRESS", "0.0.0.0"),
+		UnixSocket:                      getEnv("UNIX_SOCKET", ""),
+		SupabaseJWTSecret:               getEnv("SUPABASE_JWT_SECRET", ""),
+		AdminAPIKey:                     getEnv("ADMIN_API_KEY", ""),
+		RequestIDTrustedOnly:            getEnvBool("REQUEST_ID_TRUSTED_ONLY", false),
+		RateLimitRequests:               getEnvInt("RATE_LIMIT_REQUESTS", 60),
+		RateLimitBurst:                  getEnvInt("RATE_LIMIT_BURST", 10),
+		MaxConcurrentRequests:           getEnvInt("MAX_CONCURRENT_REQUESTS", 0),
+		QueueWaitTimeout:                getEnvDuration("QUEUE_WAIT_TIMEOUT", 0),
+		MetricsLogInterval:              getEnvDuration("METRICS_LOG_INTERVAL", 0),
+		CacheTTL:                        getEnvDuration("CACHE_TTL", 0),
+		CacheMaxEntries:                 getEnvInt("CACHE_MAX_ENTRIES", 1024),
+		PublicPaths:                     getEnvList("PUBLIC_PATHS", []string{"/health", "/ready", "/startup"}),
+		ReadyCacheTTL:                   getEnvDuration("READY_CACHE_TTL", 0),
+		CircuitBreakerBackoffMultiplier: getEnvFloat("CIRCUIT_BREAKER_BACKOFF_MULTIPLIER", 1),
+		CircuitBreakerMaxTimeout:        getEnvDuration("CIRCUIT_BREAKER_MAX_TIMEOUT", 0),
+		LogSampleRate:                   getEnvFloat("LOG_SAMPLE_RATE", 1),
+		LogSlowThresholdMS:              getEnvInt("LOG_SLOW_THRESHOLD_MS", 0),
+		AccessLogFile:                   getEnv("ACCESS_LOG_FILE", ""),
+		AccessLogMaxSizeMB:              getEnvInt("ACCESS_LOG_MAX_SIZE_MB", 100),
+		AccessLogMaxBackups:             getEnvInt("ACCESS_LOG_MAX_BACKUPS", 3),
+		IdempotencyTTL:                  getEnvDuration("IDEMPOTENCY_TTL", 0),
+		ShutdownDrainGrace:              getEnvDuration("SHUTDOWN_DRAIN_GRACE", 10*time.Second),
+		MaxConnections:                  getEnvInt("MAX_CONNECTIONS", 0),
+		PathNormalize:                   getEnv("PATH_NORMALIZE", PathNormalizeOff),
+		PathDenylist:                    getEnvList("PATH_DENYLIST", nil),
+		PathAllowlist:                   getEnvList("PATH_ALLOWLIST", nil),
+		InstanceID:                      getEnv("INSTANCE_ID", ""),
+		MaintenanceMessage:              getEnv("MAINTENANCE_MESSAGE", "service under maintenance"),
+		MaintenanceRetryAfter:           getEnvDuration("MAINTENANCE_RETRY_AFTER", time.Minute),
+		RequestTotalTimeout:             getEnvDuration("REQUEST_TOTAL_TIMEOUT", 0),
+		AnonymousIDStrategy:             getEnv("ANONYMOUS_ID_STRATEGY", "ip"),
+		AnonCookieSecure:                getEnvBool("ANON_COOKIE_SECURE", false),
+		AnonCookieDomain:                getEnv("ANON_COOKIE_DOMAIN", ""),
+		AnonCookieMaxAge:                getEnvDuration("ANON_COOKIE_MAX_AGE", 0),
+		RateLimitSubnetV4:               getEnvInt("RATE_LIMIT_SUBNET_V4", 0),
+		RateLimitSubnetV6:               getEnvInt("RATE_LIMIT_SUBNET_V6", 0),
+		PublicDomain:                    getEnv("PUBLIC_DOMAIN", ""),
+		StrictServiceURLs:               getEnvBool("STRICT_SERVICE_URLS", false),
+		BreakerFailureCodes:             parseStatusRanges(getEnv("CIRCUIT_BREAKER_FAILURE_CODES", "")),
+		DebugBodyLogging:                getEnvBool("DEBUG_BODY_LOGGING", false),
+		DebugBodyMaxBytes:               getEnvInt("DEBUG_BODY_MAX_BYTES", 2048),
+		DebugBodyRedactFields:           getEnvList("DEBUG_BODY_REDACT", []string{"password", "token", "secret"}),
+		DebugSampleRate:                 getEnvFloat("DEBUG_SAMPLE_RATE", 0),
+		DebugBufferSize:                 getEnvInt("DEBUG_BUFFER_SIZE", 100),
+		GatewayDurationHeader:           getEnvBool("GATEWAY_DURATION_HEADER", false),
+		RejectIdentityConflict:          getEnvBool("REJECT_IDENTITY_CONFLICT", false),
+		AnonRateLimitRequests:           getEnvInt("ANON_RATE_LIMIT_REQUESTS", 0),
+		AnonRateLimitBurst:              getEnvInt("ANON_RATE_LIMIT_BURST", 0),
+		RateLimitWriteRequests:          getEnvInt("RATE_LIMIT_WRITE_REQUESTS", 0),
+		RateLimitWriteBurst:             getEnvInt("RATE_LIMIT_WRITE_BURST", 0),
+		CBJitterPercent:                 getEnvInt("CB_JITTER_PERCENT", 0),
+		PanicResponseBody:               getEnv("PANIC_RESPONSE_BODY", ""),
+		PanicResponseContentType:        getEnv("PANIC_RESPONSE_CONTENT_TYPE", ""),
+		RequestTimeout:                  getEnvDuration("REQUEST_TIMEOUT", 30*time.Second),
+		CircuitBreakerThreshold:         getEnvInt("CIRCUIT_BREAKER_THRESHOLD", 5),
+		CircuitBreakerTimeout:           getEnvDuration("CIRCUIT_BREAKER_TIMEOUT", 30*time.Second),
+		CORSOrigins:                     getEnvList("CORS_ORIGINS", nil),
+		MaxRequestBodyBytes:             int64(getEnvInt("MAX_REQUEST_BODY_BYTES", 0)),
+		CompressionMinBytes:             getEnvInt("COMPRESSION_MIN_BYTES", 0),
+		ConcurrencyRetryAfter:           getEnvDuration("CONCURRENCY_RETRY_AFTER", time.Second),
+		DecompressUpstream:              getEnvBool("DECOMPRESS_UPSTREAM", false),
+		SchemaMaxBodyBytes:              int64(getEnvInt("SCHEMA_MAX_BODY_BYTES", 1<<20)),
+		LogFields:                       getEnvList("LOG_FIELDS", nil),
+		QuotaLimit:                      int64(getEnvInt("QUOTA_LIMIT", 0)),
+		QuotaPeriod:                     getEnvDuration("QUOTA_PERIOD", 24*time.Hour),
+		ResetCBOnHealthy:                getEnvBool("RESET_CB_ON_HEALTHY", false),
+		RequiredServices:                getEnvList("REQUIRED_SERVICES", nil),
+		MaxIdleConns:                    getEnvInt("MAX_IDLE_CONNS", 100),
+		MaxIdleConnsPerHost:             getEnvInt("MAX_IDLE_CONNS_PER_HOST", 20),
+		IdleConnTimeout:                 getEnvDuration("IDLE_CONN_TIMEOUT", 90*time.Second),
+	}
+
+	if cfg.RequestTimeout < MinRequestTimeout {
+		log.Printf("REQUEST_TIMEOUT %v is below the %v minimum, flooring it", cfg.RequestTimeout, MinRequestTimeout)
+		cfg.RequestTimeout = MinRequestTimeout
+	}
+
+	for _, pair := range getEnvList("API_KEYS", nil) {
+		key, tenant, ok := strings.Cut(pair, ":")
+		if !ok || key == "" || tenant == "" {
+			log.Printf("ignoring malformed API_KEYS entry %q, want key:tenant", pair)
+			continue
+		}
+		if cfg.APIKeys == nil {
+			cfg.APIKeys = make(map[string]string)
+		}
+		cfg.APIKeys[key] = tenant
+	}
+
+	for _, pair := range getEnvList("API_KEY_CONCURRENCY", nil) {
+		tenant, limit, ok := strings.Cut(pair, ":")
+		n, err := strconv.Atoi(limit)
+		if !ok || tenant == "" || err != nil || n <= 0 {
+			log.Printf("ignoring malformed API_KEY_CONCURRENCY entry %q, want tenant:limit", pair)
+			continue
+		}
+		if cfg.APIKeyConcurrency == nil {
+			cfg.APIKeyConcurrency = make(map[string]int)
+		}
+		cfg.APIKeyConcurrency[tenant] = n
+	}
+
+	for _, pair := range getEnvList("FORWARD_CLAIMS", nil) {
+		claim, header, ok := strings.Cut(pair, ":")
+		if !ok || claim == "" || header == "" {
+			log.Printf("ignoring malformed FORWARD_CLAIMS entry %q, want claim:header", pair)
+			continue
+		}
+		if cfg.ForwardClaims == nil {
+			cfg.ForwardClaims = make(map[string]string)
+		}
+		cfg.ForwardClaims[claim] = header
+	}
+
+	for _, pair := range getEnvList("RESPONSE_HEADER_REWRITE", nil) {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			log.Printf("ignoring malformed RESPONSE_HEADER_REWRITE entry %q, want name=value", pair)
+			continue
+		}
+		if cfg.ResponseHeaderRewrite == nil {
+			cfg.ResponseHeaderRewrite = make(map[string]string)
+		}
+		cfg.ResponseHeaderRewrite[name] = value
+	}
+
+	cfg.SecurityHeaders = map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Content-Security-Policy": "default-src 'none'; frame-ancestors 'none'",
+	}
+	for _, pair := range getEnvList("SECURITY_HEADERS", nil) {
+		if name, value, ok := strings.Cut(pair, "="); ok && name != "" {
+			cfg.SecurityHeaders[name] = value
+		}
+	}
+	cfg.SecurityHeadersOverride = getEnvBool("SECURITY_HEADERS_OVERRIDE", false)
+
+	for _, raw := range getEnvList("METRICS_SIZE_BUCKETS", nil) {
+		bound, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || bound <= 0 {
+			log.Printf("ignoring invalid METRICS_SIZE_BUCKETS entry %q", raw)
+			continue
+		}
+		cfg.MetricsSizeBuckets = append(cfg.MetricsSizeBuckets, bound)
+	}
+
+	for _, cidr := range getEnvList("TRUSTED_PROXIES", nil) {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Printf("ignoring invalid TRUSTED_PROXIES entry %q: %v", cidr, err)
+			continue
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, n)
+	}
+
+	cfg.Services = make(map[string]*ServiceConfig, len(serviceNames))
+	defaultPorts := map[string]string{"agent": "8001", "rag": "8002", "llm": "8003"}
+	for _, name := range serviceNames {
+		prefix := strings.ToUpper(name)
+		rawURL, explicit := os.LookupEnv(prefix + "_SERVICE_URL")
+		if rawURL == "" {
+			rawURL, explicit = "http://localhost:"+defaultPorts[name], false
+		}
+		targets := parseWeightedTargets(rawURL)
+		cfg.Services[name] = &ServiceConfig{
+			Name:                    name,
+			URL:                     targets[0].URL,
+			URLExplicit:             explicit,
+			Targets:                 targets,
+			AllowedMethods:          normalizeMethods(getEnvList(prefix+"_ALLOWED_METHODS", nil)),
+			RequestSchemaPath:       getEnv(prefix+"_REQUEST_SCHEMA", ""),
+			RequestTimeout:          getEnvDuration(prefix+"_REQUEST_TIMEOUT", 0),
+			BreakerProbeTimeout:     getEnvDuration(prefix+"_BREAKER_PROBE_TIMEOUT", 0),
+			MaxRequestBodyBytes:     int64(getEnvInt(prefix+"_MAX_REQUEST_BODY_BYTES", 0)),
+			LBMode:                  getEnv(prefix+"_LB_MODE", ""),
+			BreakerErrorSubstring:   getEnv(prefix+"_BREAKER_ERROR_SUBSTRING", ""),
+			LogRedact:               getEnvBool(prefix+"_LOG_REDACT", false),
+			ReadyCacheTTL:           getEnvDuration(prefix+"_READY_CACHE_TTL", 0),
+			PassthroughUpstreamCORS: getEnvBool(prefix+"_PASSTHROUGH_UPSTREAM_CORS", false),
+			HealthMethod:            strings.ToUpper(getEnv(prefix+"_HEALTH_METHOD", "GET")),
+			HealthPath:              getEnv(prefix+"_HEALTH_PATH", ""),
+			HealthTimeout:           getEnvDuration(prefix+"_HEALTH_TIMEOUT", 0),
+			RewriteCookies:          getEnvBool(prefix+"_REWRITE_COOKIES", false),
+			Protocol:                getEnv(prefix+"_PROTOCOL", ""),
+			ReadDeadline:            getEnvDuration(prefix+"_READ_DEADLINE", 0),
+			WriteDeadline:           getEnvDuration(prefix+"_WRITE_DEADLINE", 0),
+		}
+	}
+
+	return cfg
+}
+
+// ServiceNames returns the configured service names in probe order.
+func (c *Config) ServiceNames() []string {
+	return append([]string(nil), serviceNames...)
+}
+
+// ListenAddr returns the TCP address the server binds: BIND_ADDRESS joined
+// with PORT. Not meaningful when UnixSocket is set.
+func (c *Config) ListenAddr() string {
+	return net.JoinHostPort(c.BindAddress, c.Port)
+}
+
+// MaxRequestTimeout returns the longest request timeout across the global
+// setting and every per-service override. The server's WriteTimeout must be
+// sized from this, not from RequestTimeout alone, or a long-running service
+// like llm gets its response cut off mid-write.
+func (c *Config) MaxRequestTimeout() time.Duration {
+	max := c.RequestTimeout
+	for _, svc := range c.Services {
+		if svc.RequestTimeout > max {
+			max = svc.RequestTimeout
+		}
+	}
+	return max
+}
+
+// Validate checks the loaded configuration for values that would make the
+// gateway misbehave at runtime.
+func (c *Config) Validate() error {
+	if _, err := strconv.Atoi(c.Port); err != nil {
+		return fmt.Errorf("invalid PORT %q: %w", c.Port, err)
+	}
+	switch c.PathNormalize {
+	case "", PathNormalizeOff, PathNormalizeRedirect, PathNormalizeRewrite:
+	default:
+		return fmt.Errorf("invalid PATH_NORMALIZE %q: want off, redirect, or rewrite", c.PathNormalize)
+	}
+	if c.UnixSocket == "" && c.BindAddress != "" {
+		if net.ParseIP(c.BindAddress) == nil {
+			return fmt.Errorf("invalid BIND_ADDRESS %q: not an IP address", c.BindAddress)
+		}
+	}
+	for _, svc := range c.Services {
+		if c.StrictServiceURLs && !svc.URLExplicit && c.IsRequiredService(svc.Name) {
+			return fmt.Errorf("%s_SERVICE_URL must be set explicitly in strict mode", strings.ToUpper(svc.Name))
+		}
+		if err := validateServiceURL(svc.URL); err != nil {
+			return fmt.Errorf("invalid %s service URL %q: %w", svc.Name, svc.URL, err)
+		}
+		for _, t := range svc.Targets {
+			if err := validateServiceURL(t.URL); err != nil {
+				return fmt.Errorf("invalid %s service target %q: %w", svc.Name, t.URL, err)
+			}
+		}
+		switch svc.Protocol {
+		case "", ProtocolHTTP, ProtocolGRPCWeb:
+		default:
+			return fmt.Errorf("invalid %s_PROTOCOL %q: want http or grpc-web", strings.ToUpper(svc.Name), svc.Protocol)
+		}
+	}
+	if c.RateLimitRequests <= 0 {
+		return fmt.Errorf("RATE_LIMIT_REQUESTS must be positive, got %d", c.RateLimitRequests)
+	}
+	if c.Environment == "production" && c.SupabaseJWTSecret == "" {
+		return fmt.Errorf("SUPABASE_JWT_SECRET is required in production")
+	}
+	return nil
+}
+
+// validateServiceURL rejects upstream URLs that would only fail at request
+// time: url.Parse accepts almost anything, so require an absolute http(s)
+// URL with a host. A valid-but-unreachable URL still passes — reachability
+// is the circuit breaker's job, not startup's.
+func validateServiceURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme %q is not http or https", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host")
+	}
+	return nil
+}
+
+// IsRequiredService reports whether a service's health gates readiness. An
+// empty RequiredServices list treats every service as required.
+func (c *Config) IsRequiredService(name string) bool {
+	if len(c.RequiredServices) == 0 {
+		return true
+	}
+	for _, n := range c.RequiredServices {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSecret maps a secret to "***" when set, keeping "" visible so an
+// operator can tell configured-but-hidden from absent.
+func redactSecret(v string) string {
+	if v == "" {
+		return ""
+	}
+	return "***"
+}
+
+// Redacted returns the effective configuration as a JSON-safe map for the
+// /gateway/config introspection endpoint. Secrets (the JWT secret, admin
+// key, API keys) are redacted; everything else reflects what this process
+// actually loaded.
+func (c *Config) Redacted() map[string]interface{} {
+	services := make(map[string]interface{}, len(c.Services))
+	for name, svc := range c.Services {
+		entry := map[string]interface{}{
+			"url":             svc.URL,
+			"allowed_methods": svc.AllowedMethods,
+		}
+		if len(svc.Targets) > 1 {
+			targets := make([]map[string]interface{}, 0, len(svc.Targets))
+			for _, t := range svc.Targets {
+				targets = append(targets, map[string]interface{}{"url": t.URL, "weight": t.Weight})
+			}
+			entry["targets"] = targets
+			entry["lb_mode"] = svc.LBMode
+		}
+		services[name] = entry
+	}
+	return map[string]interface{}{
+		"environment":               c.Environment,
+		"port":                      c.Port,
+		"services":                  services,
+		"request_timeout":           c.RequestTimeout.String(),
+		"rate_limit_requests":       c.RateLimitRequests,
+		"rate_limit_burst":          c.RateLimitBurst,
+		"circuit_breaker_threshold": c.CircuitBreakerThreshold,
+		"circuit_breaker_timeout":   c.CircuitBreakerTimeout.String(),
+		"cors_origins":              c.CORSOrigins,
+		"public_paths":              c.PublicPaths,
+		"required_services":         c.RequiredServices,
+		"supabase_jwt_secret":       redactSecret(c.SupabaseJWTSecret),
+		"admin_api_key":             redactSecret(c.AdminAPIKey),
+		"api_keys_configured":       len(c.APIKeys),
+	}
+}
+
+// IsProduction reports whether the gateway runs with production strictness.
+func (c *Config) IsProduction() bool {
+	return c.Environment == "production"
+}
+
+func normalizeMethods(methods []string) []string {
+	out := make([]string, 0, len(methods))
+	for _, m := range methods {
+		out = append(out, strings.ToUpper(strings.TrimSpace(m)))
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+		log.Printf("invalid float for %s: %q, using %v", key, v, fallback)
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+func getEnvList(key string, fallback []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	parts := strings.Split(v, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
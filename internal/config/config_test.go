@@ -0,0 +1,227 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFloorsTinyRequestTimeout(t *testing.T) {
+	t.Setenv("REQUEST_TIMEOUT", "1ms")
+	cfg := Load()
+	if cfg.RequestTimeout != MinRequestTimeout {
+		t.Fatalf("RequestTimeout = %v, want floored to %v", cfg.RequestTimeout, MinRequestTimeout)
+	}
+}
+
+func TestLoadKeepsReasonableRequestTimeout(t *testing.T) {
+	t.Setenv("REQUEST_TIMEOUT", "10s")
+	cfg := Load()
+	if cfg.RequestTimeout != 10*time.Second {
+		t.Fatalf("RequestTimeout = %v, want 10s", cfg.RequestTimeout)
+	}
+}
+
+func TestValidateRejectsMalformedServiceURL(t *testing.T) {
+	for _, raw := range []string{"://bad", "localhost:8001", "ftp://files:21", "http://"} {
+		t.Setenv("AGENT_SERVICE_URL", raw)
+		cfg := Load()
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate accepted malformed AGENT_SERVICE_URL %q", raw)
+		}
+	}
+}
+
+func TestLoadSurvivesEmptyTargetList(t *testing.T) {
+	// "," parses to zero usable targets; Load must not panic indexing the
+	// pool, and Validate must reject the value with a real error.
+	t.Setenv("AGENT_SERVICE_URL", ",")
+	cfg := Load()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate accepted AGENT_SERVICE_URL \",\"")
+	}
+}
+
+func TestValidateRejectsMalformedWeightedTarget(t *testing.T) {
+	t.Setenv("LLM_SERVICE_URL", "http://v1:8003#90,not-a-url#10")
+	cfg := Load()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate accepted a malformed weighted target")
+	}
+}
+
+func TestValidateAcceptsUnreachableButValidURL(t *testing.T) {
+	t.Setenv("AGENT_SERVICE_URL", "http://definitely-not-resolvable:9999")
+	cfg := Load()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate rejected a valid (if unreachable) URL: %v", err)
+	}
+}
+
+func TestRedactedHidesSecretsKeepsSettings(t *testing.T) {
+	t.Setenv("SUPABASE_JWT_SECRET", "super-secret")
+	t.Setenv("ADMIN_API_KEY", "admin-secret")
+	t.Setenv("API_KEYS", "key-1:tenant-a,key-2:tenant-b")
+	t.Setenv("AGENT_SERVICE_URL", "http://agent:8001")
+	cfg := Load()
+
+	red := cfg.Redacted()
+	if red["supabase_jwt_secret"] != "***" {
+		t.Errorf("supabase_jwt_secret = %v, want ***", red["supabase_jwt_secret"])
+	}
+	if red["admin_api_key"] != "***" {
+		t.Errorf("admin_api_key = %v, want ***", red["admin_api_key"])
+	}
+	if red["api_keys_configured"] != 2 {
+		t.Errorf("api_keys_configured = %v, want 2", red["api_keys_configured"])
+	}
+
+	services := red["services"].(map[string]interface{})
+	agent := services["agent"].(map[string]interface{})
+	if agent["url"] != "http://agent:8001" {
+		t.Errorf("agent url = %v, want http://agent:8001", agent["url"])
+	}
+	if red["rate_limit_requests"] != cfg.RateLimitRequests {
+		t.Errorf("rate_limit_requests = %v, want %d", red["rate_limit_requests"], cfg.RateLimitRequests)
+	}
+
+	// Nothing in the serialized form may contain a raw secret.
+	b, err := json.Marshal(red)
+	if err != nil {
+		t.Fatalf("marshaling redacted config: %v", err)
+	}
+	for _, secret := range []string{"super-secret", "admin-secret", "key-1", "key-2"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("redacted config leaks %q", secret)
+		}
+	}
+}
+
+func TestRedactedShowsUnsetSecretsAsEmpty(t *testing.T) {
+	cfg := Load()
+	if got := cfg.Redacted()["supabase_jwt_secret"]; got != "" {
+		t.Errorf("unset secret = %v, want empty string", got)
+	}
+}
+
+func TestStrictModeFailsOnUnsetRequiredServiceURL(t *testing.T) {
+	t.Setenv("STRICT_SERVICE_URLS", "true")
+	t.Setenv("AGENT_SERVICE_URL", "http://agent:8001")
+	t.Setenv("RAG_SERVICE_URL", "http://rag:8002")
+	t.Setenv("LLM_SERVICE_URL", "")
+	cfg := Load()
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate passed with LLM_SERVICE_URL unset in strict mode")
+	}
+	if !strings.Contains(err.Error(), "LLM_SERVICE_URL") {
+		t.Errorf("error %q should name the missing variable", err)
+	}
+}
+
+func TestStrictModePassesWithAllRequiredURLsSet(t *testing.T) {
+	t.Setenv("STRICT_SERVICE_URLS", "true")
+	t.Setenv("AGENT_SERVICE_URL", "http://agent:8001")
+	t.Setenv("RAG_SERVICE_URL", "http://rag:8002")
+	t.Setenv("LLM_SERVICE_URL", "http://llm:8003")
+	cfg := Load()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestStrictModeIgnoresOptionalServices(t *testing.T) {
+	t.Setenv("STRICT_SERVICE_URLS", "true")
+	t.Setenv("REQUIRED_SERVICES", "agent")
+	t.Setenv("AGENT_SERVICE_URL", "http://agent:8001")
+	t.Setenv("RAG_SERVICE_URL", "")
+	t.Setenv("LLM_SERVICE_URL", "")
+	cfg := Load()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate should only require configured URLs for required services: %v", err)
+	}
+}
+
+func TestDefaultModeKeepsLocalhostFallback(t *testing.T) {
+	t.Setenv("AGENT_SERVICE_URL", "")
+	cfg := Load()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if cfg.Services["agent"].URL != "http://localhost:8001" {
+		t.Errorf("agent URL = %q, want localhost default", cfg.Services["agent"].URL)
+	}
+}
+
+func TestIsBreakerFailure(t *testing.T) {
+	cfg := &Config{}
+	if !cfg.IsBreakerFailure(500) || !cfg.IsBreakerFailure(599) {
+		t.Error("default predicate should count 5xx as failures")
+	}
+	if cfg.IsBreakerFailure(429) || cfg.IsBreakerFailure(200) {
+		t.Error("default predicate should ignore non-5xx statuses")
+	}
+
+	cfg.BreakerFailureCodes = parseStatusRanges("500-599, 429")
+	for _, status := range []int{429, 500, 503, 599} {
+		if !cfg.IsBreakerFailure(status) {
+			t.Errorf("configured predicate should count %d as a failure", status)
+		}
+	}
+	for _, status := range []int{200, 404, 428, 430} {
+		if cfg.IsBreakerFailure(status) {
+			t.Errorf("configured predicate should ignore %d", status)
+		}
+	}
+}
+
+func TestParseStatusRangesSkipsMalformedEntries(t *testing.T) {
+	got := parseStatusRanges("429,garbage,502-500,500-599,")
+	want := []StatusRange{{Lo: 429, Hi: 429}, {Lo: 500, Hi: 599}}
+	if len(got) != len(want) {
+		t.Fatalf("parseStatusRanges = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("range %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestListenAddrFormation(t *testing.T) {
+	cfg := &Config{BindAddress: "0.0.0.0", Port: "8080"}
+	if got := cfg.ListenAddr(); got != "0.0.0.0:8080" {
+		t.Errorf("ListenAddr = %q, want 0.0.0.0:8080", got)
+	}
+	cfg = &Config{BindAddress: "127.0.0.1", Port: "9000"}
+	if got := cfg.ListenAddr(); got != "127.0.0.1:9000" {
+		t.Errorf("ListenAddr = %q, want 127.0.0.1:9000", got)
+	}
+	cfg = &Config{BindAddress: "::1", Port: "8080"}
+	if got := cfg.ListenAddr(); got != "[::1]:8080" {
+		t.Errorf("ListenAddr = %q, want the IPv6 form [::1]:8080", got)
+	}
+}
+
+func TestValidateRejectsBadBindAddress(t *testing.T) {
+	t.Setenv("BIND_ADDRESS", "not-an-ip")
+	cfg := Load()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate accepted a non-IP BIND_ADDRESS")
+	}
+
+	t.Setenv("BIND_ADDRESS", "127.0.0.1")
+	cfg = Load()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate rejected loopback bind address: %v", err)
+	}
+
+	// A Unix socket deployment doesn't use the bind address at all.
+	t.Setenv("BIND_ADDRESS", "ignored")
+	t.Setenv("UNIX_SOCKET", "/tmp/gw.sock")
+	cfg = Load()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate rejected unix-socket config: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+// Package drain tracks long-lived connections — hijacked WebSockets and
+// streaming responses — that net/http's graceful shutdown cannot see, so the
+// gateway can end them cleanly instead of abandoning them at exit.
+package drain
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// entry pairs a tracked connection with its registration sequence so
+// shutdown can close connections in the order they were opened.
+type entry struct {
+	seq  int64
+	conn io.Closer
+}
+
+// Registry holds the gateway's active long-lived connections keyed by
+// request ID. Handlers register a connection when they take it over and
+// deregister it when it ends on its own.
+type Registry struct {
+	conns sync.Map // request ID -> entry
+	seq   atomic.Int64
+}
+
+// NewRegistry returns an empty connection registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register tracks conn under the given request ID, replacing any previous
+// registration for the same ID.
+func (r *Registry) Register(id string, conn io.Closer) {
+	r.conns.Store(id, entry{seq: r.seq.Add(1), conn: conn})
+}
+
+// Deregister stops tracking the connection for the given request ID. It is
+// safe to call for IDs that were never registered.
+func (r *Registry) Deregister(id string) {
+	r.conns.Delete(id)
+}
+
+// Active returns the number of tracked connections.
+func (r *Registry) Active() int {
+	n := 0
+	r.conns.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// Shutdown waits up to grace for tracked connections to finish on their
+// own, then force-closes whatever remains, oldest registration first. It
+// returns the number of connections that had to be closed.
+func (r *Registry) Shutdown(grace time.Duration) int {
+	deadline := time.Now().Add(grace)
+	for r.Active() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var remaining []entry
+	r.conns.Range(func(key, value interface{}) bool {
+		remaining = append(remaining, value.(entry))
+		r.conns.Delete(key)
+		return true
+	})
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i].seq < remaining[j].seq })
+	for _, e := range remaining {
+		e.conn.Close()
+	}
+	return len(remaining)
+}
@@ -0,0 +1,72 @@
+package drain
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeConn records whether it was closed.
+type fakeConn struct {
+	closed chan struct{}
+}
+
+func newFakeConn() *fakeConn { return &fakeConn{closed: make(chan struct{})} }
+
+func (c *fakeConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestShutdownForceClosesRemaining(t *testing.T) {
+	reg := NewRegistry()
+	a, b := newFakeConn(), newFakeConn()
+	reg.Register("req-a", a)
+	reg.Register("req-b", b)
+
+	start := time.Now()
+	if n := reg.Shutdown(50 * time.Millisecond); n != 2 {
+		t.Fatalf("Shutdown closed %d connections, want 2", n)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Shutdown returned after %v, want it to wait out the %v grace", elapsed, 50*time.Millisecond)
+	}
+
+	select {
+	case <-a.closed:
+	default:
+		t.Error("connection a not closed")
+	}
+	select {
+	case <-b.closed:
+	default:
+		t.Error("connection b not closed")
+	}
+	if got := reg.Active(); got != 0 {
+		t.Errorf("Active = %d after shutdown, want 0", got)
+	}
+}
+
+func TestShutdownSkipsConnectionsThatFinish(t *testing.T) {
+	reg := NewRegistry()
+	c := newFakeConn()
+	reg.Register("req-1", c)
+	reg.Deregister("req-1")
+
+	if n := reg.Shutdown(10 * time.Millisecond); n != 0 {
+		t.Fatalf("Shutdown closed %d connections, want 0", n)
+	}
+	select {
+	case <-c.closed:
+		t.Error("deregistered connection was closed")
+	default:
+	}
+}
+
+func TestShutdownReturnsEarlyWhenIdle(t *testing.T) {
+	reg := NewRegistry()
+	start := time.Now()
+	reg.Shutdown(time.Second)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Shutdown with no connections took %v, want an early return", elapsed)
+	}
+}
@@ -0,0 +1,284 @@
+// Package health implements the gateway's liveness and readiness handlers.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/breaker"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/liveness"
+)
+
+// HealthHandler is the liveness probe: the process is alive and none of its
+// registered background components (e.g. the rate-limit sweeper) have
+// stopped heartbeating. Dependency health belongs to /ready, not here. A
+// nil registry reports only process liveness.
+func HealthHandler(reg *liveness.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if reg != nil {
+			if stale := reg.Stale(); len(stale) > 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status": "unhealthy",
+					"dead":   stale,
+				})
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+	}
+}
+
+// HealthChecker reports the health of an external dependency — a Redis
+// rate-limit store, a database — that /ready should gate on alongside the
+// HTTP backend probes.
+type HealthChecker interface {
+	// Name identifies the dependency in the readiness response.
+	Name() string
+	// Check returns nil when the dependency is usable.
+	Check(ctx context.Context) error
+}
+
+// depCheckTimeout bounds each dependency check, mirroring the default probe
+// client's timeout.
+const depCheckTimeout = 2 * time.Second
+
+// cachedProbe is one backend's last readiness result and its expiry.
+type cachedProbe struct {
+	healthy bool
+	expires time.Time
+}
+
+// probeCache remembers recent readiness results per service so frequent
+// /ready polling doesn't turn into a probe storm on the backends.
+type probeCache struct {
+	mu      sync.Mutex
+	results map[string]cachedProbe
+}
+
+// get returns the cached result for name if it hasn't expired.
+func (c *probeCache) get(name string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.results[name]
+	if !ok || time.Now().After(p.expires) {
+		return false, false
+	}
+	return p.healthy, true
+}
+
+// put stores a probe result for name, expiring after ttl.
+func (c *probeCache) put(name string, healthy bool, ttl time.Duration) {
+	c.mu.Lock()
+	c.results[name] = cachedProbe{healthy: healthy, expires: time.Now().Add(ttl)}
+	c.mu.Unlock()
+}
+
+// readyCacheTTL resolves the effective readiness cache TTL for a service:
+// its own READY_CACHE_TTL when set, else the global one.
+func readyCacheTTL(svc *config.ServiceConfig, cfg *config.Config) time.Duration {
+	if svc.ReadyCacheTTL > 0 {
+		return svc.ReadyCacheTTL
+	}
+	return cfg.ReadyCacheTTL
+}
+
+// ServiceHealthChecker probes one backend service's health endpoint;
+// ReadyHandler takes it as an interface so tests can supply a fake instead
+// of standing up HTTP servers.
+type ServiceHealthChecker interface {
+	CheckService(svc *config.ServiceConfig) bool
+}
+
+// HTTPHealthChecker is the production ServiceHealthChecker: an HTTP request
+// to the service's health path using its configured method and timeout.
+type HTTPHealthChecker struct {
+	// Client is the probe client; nil falls back to a short-timeout default.
+	Client *http.Client
+}
+
+// CheckService probes the service's health endpoint (HEALTH_PATH, default
+// /health) and reports whether it answered 200.
+func (h *HTTPHealthChecker) CheckService(svc *config.ServiceConfig) bool {
+	client := h.Client
+	if client == nil {
+		client = &http.Client{Timeout: depCheckTimeout}
+	}
+	method := svc.HealthMethod
+	if method == "" {
+		method = http.MethodGet
+	}
+	path := svc.HealthPath
+	if path == "" {
+		path = "/health"
+	}
+	req, err := http.NewRequest(method, svc.URL+path, nil)
+	if err != nil {
+		return false
+	}
+	if svc.HealthTimeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), svc.HealthTimeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// ReadyHandler probes each backend service and reports readiness. The
+// response lists per-service health and the gateway is ready only when every
+// backend is reachable. Probe results are cached per service for its
+// READY_CACHE_TTL (zero re-probes every time). client is the probe client,
+// sharing the gateway's upstream transport; nil falls back to a
+// short-timeout default.
+// Registered dependency checkers are probed alongside the services; any
+// failing dependency makes the gateway not ready.
+func ReadyHandler(cfg *config.Config, breakers map[string]*breaker.CircuitBreaker, client *http.Client, deps ...HealthChecker) http.HandlerFunc {
+	if client == nil {
+		client = &http.Client{Timeout: depCheckTimeout}
+	}
+	return ReadyHandlerWith(cfg, breakers, &HTTPHealthChecker{Client: client}, deps...)
+}
+
+// ReadyHandlerWith is ReadyHandler with an injected service checker, used by
+// tests to exercise the readiness logic without real backends.
+func ReadyHandlerWith(cfg *config.Config, breakers map[string]*breaker.CircuitBreaker, checker ServiceHealthChecker, deps ...HealthChecker) http.HandlerFunc {
+	cache := &probeCache{results: make(map[string]cachedProbe)}
+	return func(w http.ResponseWriter, r *http.Request) {
+		names := cfg.ServiceNames()
+		// ?checks=agent,rag probes only the named services.
+		if checks := r.URL.Query().Get("checks"); checks != "" {
+			names = names[:0]
+			for _, n := range strings.Split(checks, ",") {
+				if n = strings.TrimSpace(n); n != "" {
+					if _, ok := cfg.Services[n]; ok {
+						names = append(names, n)
+					}
+				}
+			}
+		}
+
+		services := make(map[string]string, len(names))
+		ready := true
+
+		// Probe the backends concurrently so /ready completes in roughly
+		// one check's duration instead of the sum of all of them.
+		var (
+			mu sync.Mutex
+			wg sync.WaitGroup
+		)
+		for _, name := range names {
+			svc, ok := cfg.Services[name]
+			if !ok {
+				continue
+			}
+			wg.Add(1)
+			go func(name string, svc *config.ServiceConfig) {
+				defer wg.Done()
+				healthy, cached := cache.get(name)
+				if !cached {
+					healthy = checker.CheckService(svc)
+					if ttl := readyCacheTTL(svc, cfg); ttl > 0 {
+						cache.put(name, healthy, ttl)
+					}
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if healthy {
+					services[name] = "healthy"
+					// Optionally clear a tripped breaker; off by default so
+					// a probe can't mask a backend failing under real load.
+					if cfg.ResetCBOnHealthy {
+						if cb := breakers[name]; cb != nil {
+							cb.Reset()
+						}
+					}
+				} else {
+					services[name] = "unhealthy"
+					// Only required services gate readiness; optional ones
+					// still appear in the map with their state.
+					if cfg.IsRequiredService(name) {
+						ready = false
+					}
+				}
+			}(name, svc)
+		}
+		dependencies := make(map[string]string, len(deps))
+		for _, dep := range deps {
+			wg.Add(1)
+			go func(dep HealthChecker) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(r.Context(), depCheckTimeout)
+				defer cancel()
+				err := dep.Check(ctx)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					dependencies[dep.Name()] = err.Error()
+					ready = false
+				} else {
+					dependencies[dep.Name()] = "healthy"
+				}
+			}(dep)
+		}
+		wg.Wait()
+
+		status := "ready"
+		code := http.StatusOK
+		if !ready {
+			status = "not ready"
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		body := map[string]interface{}{
+			"status":   status,
+			"services": services,
+		}
+		if len(dependencies) > 0 {
+			body["dependencies"] = dependencies
+		}
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// StartupGate is flipped once at the end of gateway initialization; the
+// startup probe fails until then so Kubernetes doesn't kill a slow-starting
+// pod via its liveness probe.
+type StartupGate struct {
+	done atomic.Bool
+}
+
+// MarkReady records that initialization has completed.
+func (g *StartupGate) MarkReady() { g.done.Store(true) }
+
+// Done reports whether initialization has completed.
+func (g *StartupGate) Done() bool { return g.done.Load() }
+
+// StartupHandler serves the Kubernetes startupProbe: 503 until the gate is
+// marked ready, 200 afterwards.
+func StartupHandler(gate *StartupGate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !gate.Done() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"status": "starting"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "started"})
+	}
+}
@@ -0,0 +1,428 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/breaker"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/liveness"
+)
+
+func healthyBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func readyConfig(services map[string]*config.ServiceConfig) *config.Config {
+	return &config.Config{Environment: "test", Services: services}
+}
+
+func decodeReady(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding readiness body: %v", err)
+	}
+	return body
+}
+
+func TestOptionalServiceDownKeepsReadiness(t *testing.T) {
+	up := healthyBackend(t)
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+
+	cfg := readyConfig(map[string]*config.ServiceConfig{
+		"agent": {Name: "agent", URL: up.URL},
+		"rag":   {Name: "rag", URL: up.URL},
+		"llm":   {Name: "llm", URL: down.URL},
+	})
+	cfg.RequiredServices = []string{"agent", "rag"}
+
+	rec := httptest.NewRecorder()
+	ReadyHandler(cfg, nil, nil)(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200 with only the optional llm down", rec.Code)
+	}
+	body := decodeReady(t, rec)
+	services := body["services"].(map[string]interface{})
+	if services["llm"] != "unhealthy" {
+		t.Fatalf("llm should still be reported unhealthy, got %v", services["llm"])
+	}
+}
+
+func TestRequiredServiceDownFailsReadiness(t *testing.T) {
+	up := healthyBackend(t)
+	cfg := readyConfig(map[string]*config.ServiceConfig{
+		"agent": {Name: "agent", URL: "http://127.0.0.1:1"},
+		"rag":   {Name: "rag", URL: up.URL},
+		"llm":   {Name: "llm", URL: up.URL},
+	})
+
+	rec := httptest.NewRecorder()
+	ReadyHandler(cfg, nil, nil)(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want 503 with a required service down", rec.Code)
+	}
+}
+
+func TestChecksParamProbesOnlyNamedServices(t *testing.T) {
+	up := healthyBackend(t)
+	cfg := readyConfig(map[string]*config.ServiceConfig{
+		"agent": {Name: "agent", URL: up.URL},
+		"rag":   {Name: "rag", URL: up.URL},
+		"llm":   {Name: "llm", URL: "http://127.0.0.1:1"},
+	})
+
+	rec := httptest.NewRecorder()
+	ReadyHandler(cfg, map[string]*breaker.CircuitBreaker{}, nil)(rec,
+		httptest.NewRequest(http.MethodGet, "/ready?checks=agent,rag", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200 when only healthy services are probed", rec.Code)
+	}
+	services := decodeReady(t, rec)["services"].(map[string]interface{})
+	if _, probed := services["llm"]; probed {
+		t.Fatal("llm should not have been probed")
+	}
+}
+
+func TestReadyProbesRunConcurrently(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+
+	cfg := readyConfig(map[string]*config.ServiceConfig{
+		"agent": {Name: "agent", URL: slow.URL},
+		"rag":   {Name: "rag", URL: slow.URL},
+		"llm":   {Name: "llm", URL: slow.URL},
+	})
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	ReadyHandler(cfg, nil, nil)(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("three 200ms probes took %v, want them concurrent (~200ms)", elapsed)
+	}
+}
+
+func TestReadyProbeLeavesOpenBreakerAlone(t *testing.T) {
+	up := healthyBackend(t)
+	cfg := readyConfig(map[string]*config.ServiceConfig{
+		"agent": {Name: "agent", URL: up.URL},
+		"rag":   {Name: "rag", URL: up.URL},
+		"llm":   {Name: "llm", URL: up.URL},
+	})
+
+	cb := breaker.New(1, time.Hour)
+	cb.RecordFailure()
+	breakers := map[string]*breaker.CircuitBreaker{"agent": cb}
+
+	rec := httptest.NewRecorder()
+	ReadyHandler(cfg, breakers, nil)(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	if cb.State() != breaker.StateOpen {
+		t.Fatalf("breaker state = %v, want still open after a readiness probe", cb.State())
+	}
+}
+
+func TestReadyProbeResetsBreakerWhenEnabled(t *testing.T) {
+	up := healthyBackend(t)
+	cfg := readyConfig(map[string]*config.ServiceConfig{
+		"agent": {Name: "agent", URL: up.URL},
+		"rag":   {Name: "rag", URL: up.URL},
+		"llm":   {Name: "llm", URL: up.URL},
+	})
+	cfg.ResetCBOnHealthy = true
+
+	cb := breaker.New(1, time.Hour)
+	cb.RecordFailure()
+	breakers := map[string]*breaker.CircuitBreaker{"agent": cb}
+
+	rec := httptest.NewRecorder()
+	ReadyHandler(cfg, breakers, nil)(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	if cb.State() != breaker.StateClosed {
+		t.Fatalf("breaker state = %v, want reset to closed with RESET_CB_ON_HEALTHY", cb.State())
+	}
+}
+
+func TestStaleHeartbeatFailsLiveness(t *testing.T) {
+	reg := liveness.NewRegistry(20 * time.Millisecond)
+	reg.Register("ratelimit-sweeper")
+	handler := HealthHandler(reg)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("fresh heartbeat: got status %d, want 200", rec.Code)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("stale heartbeat: got status %d, want 503", rec.Code)
+	}
+}
+
+func TestStartupProbeFlipsAfterInit(t *testing.T) {
+	gate := &StartupGate{}
+	handler := StartupHandler(gate)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/startup", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("before init: got status %d, want 503", rec.Code)
+	}
+
+	gate.MarkReady()
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/startup", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("after init: got status %d, want 200", rec.Code)
+	}
+}
+
+func TestPerServiceReadyCacheTTL(t *testing.T) {
+	var agentProbes, ragProbes atomic.Int64
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agentProbes.Add(1)
+	}))
+	defer agent.Close()
+	rag := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ragProbes.Add(1)
+	}))
+	defer rag.Close()
+
+	cfg := readyConfig(map[string]*config.ServiceConfig{
+		"agent": {Name: "agent", URL: agent.URL, ReadyCacheTTL: 30 * time.Millisecond},
+		"rag":   {Name: "rag", URL: rag.URL, ReadyCacheTTL: time.Minute},
+	})
+	handler := ReadyHandler(cfg, nil, nil)
+
+	probe := func() {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ready", nil))
+	}
+
+	probe()
+	probe()
+	if agentProbes.Load() != 1 || ragProbes.Load() != 1 {
+		t.Fatalf("probes within TTL = agent %d, rag %d; want 1 each (cached)",
+			agentProbes.Load(), ragProbes.Load())
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	probe()
+	if agentProbes.Load() != 2 {
+		t.Errorf("agent probes after short TTL expiry = %d, want 2", agentProbes.Load())
+	}
+	if ragProbes.Load() != 1 {
+		t.Errorf("rag probes within long TTL = %d, want still 1", ragProbes.Load())
+	}
+}
+
+func TestZeroReadyCacheTTLProbesEveryTime(t *testing.T) {
+	var probes atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+	}))
+	defer backend.Close()
+
+	cfg := readyConfig(map[string]*config.ServiceConfig{
+		"agent": {Name: "agent", URL: backend.URL},
+	})
+	handler := ReadyHandler(cfg, nil, nil)
+	for i := 0; i < 3; i++ {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ready", nil))
+	}
+	if probes.Load() != 3 {
+		t.Fatalf("probes = %d, want 3 with caching disabled", probes.Load())
+	}
+}
+
+func TestHealthMethodHEADProbesWithHEAD(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// This upstream only accepts HEAD on its health path.
+		if r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+	}))
+	defer backend.Close()
+
+	cfg := readyConfig(map[string]*config.ServiceConfig{
+		"agent": {Name: "agent", URL: backend.URL, HealthMethod: http.MethodHead},
+	})
+	rec := httptest.NewRecorder()
+	ReadyHandler(cfg, nil, nil)(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("readiness = %d, want 200 via HEAD probe", rec.Code)
+	}
+	body := decodeReady(t, rec)
+	if got := body["services"].(map[string]interface{})["agent"]; got != "healthy" {
+		t.Errorf("agent state = %v, want healthy", got)
+	}
+}
+
+// fakeDep is a HealthChecker returning a fixed error.
+type fakeDep struct {
+	name string
+	err  error
+}
+
+func (d fakeDep) Name() string                { return d.name }
+func (d fakeDep) Check(context.Context) error { return d.err }
+
+func TestFailingDependencyFlipsReadiness(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Services: map[string]*config.ServiceConfig{
+			"agent": {Name: "agent", URL: backend.URL},
+			"rag":   {Name: "rag", URL: backend.URL},
+			"llm":   {Name: "llm", URL: backend.URL},
+		},
+	}
+
+	handler := ReadyHandler(cfg, nil, nil, fakeDep{name: "redis", err: errors.New("connection refused")})
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d with a failing dependency, want 503", rec.Code)
+	}
+	var body struct {
+		Status       string            `json:"status"`
+		Dependencies map[string]string `json:"dependencies"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if body.Dependencies["redis"] != "connection refused" {
+		t.Errorf("dependencies[redis] = %q, want the check error", body.Dependencies["redis"])
+	}
+
+	// A healthy dependency leaves readiness intact.
+	handler = ReadyHandler(cfg, nil, nil, fakeDep{name: "redis"})
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d with a healthy dependency, want 200", rec.Code)
+	}
+}
+
+// fakeServiceChecker returns canned per-service results and records which
+// services were probed.
+type fakeServiceChecker struct {
+	mu      sync.Mutex
+	healthy map[string]bool
+	probed  []string
+}
+
+func (f *fakeServiceChecker) CheckService(svc *config.ServiceConfig) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.probed = append(f.probed, svc.Name)
+	return f.healthy[svc.Name]
+}
+
+func TestReadyHandlerWithMockChecker(t *testing.T) {
+	cfg := &config.Config{
+		Services: map[string]*config.ServiceConfig{
+			"agent": {Name: "agent", URL: "http://agent.internal"},
+			"rag":   {Name: "rag", URL: "http://rag.internal"},
+			"llm":   {Name: "llm", URL: "http://llm.internal"},
+		},
+	}
+
+	checker := &fakeServiceChecker{healthy: map[string]bool{"agent": true, "rag": true, "llm": true}}
+	handler := ReadyHandlerWith(cfg, nil, checker)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("all healthy: got status %d, want 200", rec.Code)
+	}
+	if len(checker.probed) != 3 {
+		t.Errorf("probed %v, want all three services", checker.probed)
+	}
+
+	checker = &fakeServiceChecker{healthy: map[string]bool{"agent": true, "rag": true}}
+	handler = ReadyHandlerWith(cfg, nil, checker)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("llm unhealthy: got status %d, want 503", rec.Code)
+	}
+	var body struct {
+		Services map[string]string `json:"services"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if body.Services["llm"] != "unhealthy" || body.Services["agent"] != "healthy" {
+		t.Errorf("services = %v, want llm unhealthy and agent healthy", body.Services)
+	}
+}
+
+func TestHTTPCheckerUsesConfiguredPath(t *testing.T) {
+	paths := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	checker := &HTTPHealthChecker{}
+	svc := &config.ServiceConfig{Name: "rag", URL: backend.URL, HealthPath: "/internal/healthz"}
+	if !checker.CheckService(svc) {
+		t.Fatal("CheckService = false for a 200 backend")
+	}
+	if got := <-paths; got != "/internal/healthz" {
+		t.Errorf("probed path %q, want /internal/healthz", got)
+	}
+}
+
+func TestHTTPCheckerHonorsPerServiceTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer backend.Close()
+
+	checker := &HTTPHealthChecker{}
+	svc := &config.ServiceConfig{Name: "agent", URL: backend.URL, HealthTimeout: 20 * time.Millisecond}
+	start := time.Now()
+	if checker.CheckService(svc) {
+		t.Fatal("CheckService = true for a timed-out probe")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("probe took %v, want it bounded by the 20ms per-service timeout", elapsed)
+	}
+}
@@ -0,0 +1,140 @@
+// Package jsonschema implements the subset of JSON Schema the gateway uses
+// to validate request bodies at the edge: types, required properties, enums,
+// and basic string/number bounds.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Schema is a parsed (subset of a) JSON Schema document.
+type Schema struct {
+	Type                 string             `json:"type"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	Items                *Schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+}
+
+// Parse decodes a schema document.
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing schema: %w", err)
+	}
+	return &s, nil
+}
+
+// LoadFile reads and parses a schema file.
+func LoadFile(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading schema %s: %w", path, err)
+	}
+	return Parse(data)
+}
+
+// Validate checks a decoded JSON value against the schema and returns one
+// message per violation, empty when the value conforms.
+func (s *Schema) Validate(v interface{}) []string {
+	return s.validate(v, "$")
+}
+
+func (s *Schema) validate(v interface{}, path string) []string {
+	var errs []string
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s: value not in enum", path))
+		}
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return append(errs, fmt.Sprintf("%s: expected object", path))
+		}
+		for _, req := range s.Required {
+			if _, present := obj[req]; !present {
+				errs = append(errs, fmt.Sprintf("%s.%s: required property missing", path, req))
+			}
+		}
+		for name, sub := range s.Properties {
+			if val, present := obj[name]; present {
+				errs = append(errs, sub.validate(val, path+"."+name)...)
+			}
+		}
+		if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+			for name := range obj {
+				if _, known := s.Properties[name]; !known {
+					errs = append(errs, fmt.Sprintf("%s.%s: unexpected property", path, name))
+				}
+			}
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return append(errs, fmt.Sprintf("%s: expected array", path))
+		}
+		if s.Items != nil {
+			for i, item := range arr {
+				errs = append(errs, s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return append(errs, fmt.Sprintf("%s: expected string", path))
+		}
+		if s.MinLength != nil && len(str) < *s.MinLength {
+			errs = append(errs, fmt.Sprintf("%s: shorter than minLength %d", path, *s.MinLength))
+		}
+		if s.MaxLength != nil && len(str) > *s.MaxLength {
+			errs = append(errs, fmt.Sprintf("%s: longer than maxLength %d", path, *s.MaxLength))
+		}
+	case "number", "integer":
+		num, ok := v.(float64)
+		if !ok {
+			return append(errs, fmt.Sprintf("%s: expected %s", path, s.Type))
+		}
+		if s.Type == "integer" && num != float64(int64(num)) {
+			errs = append(errs, fmt.Sprintf("%s: expected integer", path))
+		}
+		if s.Minimum != nil && num < *s.Minimum {
+			errs = append(errs, fmt.Sprintf("%s: below minimum %v", path, *s.Minimum))
+		}
+		if s.Maximum != nil && num > *s.Maximum {
+			errs = append(errs, fmt.Sprintf("%s: above maximum %v", path, *s.Maximum))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			errs = append(errs, fmt.Sprintf("%s: expected boolean", path))
+		}
+	case "null":
+		if v != nil {
+			errs = append(errs, fmt.Sprintf("%s: expected null", path))
+		}
+	}
+	return errs
+}
+
+func jsonEqual(a, b interface{}) bool {
+	aj, err1 := json.Marshal(a)
+	bj, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && string(aj) == string(bj)
+}
@@ -0,0 +1,65 @@
+// Package liveness tracks heartbeats from the gateway's background
+// components so the liveness probe can fail when one of them dies.
+package liveness
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultMaxAge is how stale a heartbeat may be before the component is
+// considered dead. Background loops beat far more often than this.
+const DefaultMaxAge = 5 * time.Minute
+
+// Registry records the last heartbeat per registered component.
+type Registry struct {
+	mu     sync.Mutex
+	maxAge time.Duration
+	beats  map[string]time.Time
+}
+
+// NewRegistry returns a registry that considers heartbeats older than maxAge
+// stale.
+func NewRegistry(maxAge time.Duration) *Registry {
+	return &Registry{
+		maxAge: maxAge,
+		beats:  make(map[string]time.Time),
+	}
+}
+
+// Default is the process-wide registry used by main and the background
+// components.
+var Default = NewRegistry(DefaultMaxAge)
+
+// Register adds a component, counting registration as its first beat.
+func (r *Registry) Register(name string) {
+	r.Beat(name)
+}
+
+// Beat records a heartbeat for a component.
+func (r *Registry) Beat(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.beats[name] = time.Now()
+}
+
+// Stale returns the components whose last beat is older than the registry's
+// max age.
+func (r *Registry) Stale() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var stale []string
+	cutoff := time.Now().Add(-r.maxAge)
+	for name, last := range r.beats {
+		if last.Before(cutoff) {
+			stale = append(stale, name)
+		}
+	}
+	return stale
+}
+
+// Register registers a component with the default registry.
+func Register(name string) { Default.Register(name) }
+
+// Beat records a heartbeat with the default registry.
+func Beat(name string) { Default.Beat(name) }
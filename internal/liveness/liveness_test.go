@@ -0,0 +1,26 @@
+package liveness
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStaleHeartbeatIsReported(t *testing.T) {
+	reg := NewRegistry(30 * time.Millisecond)
+	reg.Register("sweeper")
+
+	if stale := reg.Stale(); len(stale) != 0 {
+		t.Fatalf("fresh heartbeat reported stale: %v", stale)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	stale := reg.Stale()
+	if len(stale) != 1 || stale[0] != "sweeper" {
+		t.Fatalf("Stale() = %v, want [sweeper]", stale)
+	}
+
+	reg.Beat("sweeper")
+	if stale := reg.Stale(); len(stale) != 0 {
+		t.Fatalf("beat should clear staleness, got %v", stale)
+	}
+}
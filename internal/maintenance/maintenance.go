@@ -0,0 +1,51 @@
+// Package maintenance tracks which backend services are deliberately taken
+// out of rotation, so the gateway can answer for them with a friendly 503
+// during deploys instead of surfacing connection errors.
+package maintenance
+
+import "sync"
+
+// Registry holds the per-service maintenance flags. It is safe for
+// concurrent use: the admin endpoint flips flags while requests read them.
+type Registry struct {
+	mu    sync.RWMutex
+	flags map[string]bool
+}
+
+// NewRegistry returns a registry with no services in maintenance.
+func NewRegistry() *Registry {
+	return &Registry{flags: make(map[string]bool)}
+}
+
+// Default is the process-wide registry shared by the proxy handlers and the
+// admin toggle endpoint.
+var Default = NewRegistry()
+
+// Set flips the maintenance flag for a service.
+func (r *Registry) Set(name string, enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if enabled {
+		r.flags[name] = true
+	} else {
+		delete(r.flags, name)
+	}
+}
+
+// Enabled reports whether a service is in maintenance.
+func (r *Registry) Enabled(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.flags[name]
+}
+
+// Snapshot returns the services currently in maintenance.
+func (r *Registry) Snapshot() map[string]bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]bool, len(r.flags))
+	for name := range r.flags {
+		out[name] = true
+	}
+	return out
+}
@@ -0,0 +1,224 @@
+// Package metrics aggregates in-process request counters and periodically
+// flushes them to the log, for environments that only scrape logs.
+package metrics
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultSizeBuckets are the size-histogram upper bounds in bytes used when
+// METRICS_SIZE_BUCKETS is not configured, stepped for typical JSON API
+// payloads up to large llm prompts.
+var DefaultSizeBuckets = []int64{256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// Collector accumulates per-service request counters between flushes, plus
+// cumulative request/response size histograms for capacity planning.
+type Collector struct {
+	mu          sync.Mutex
+	requests    map[string]int64
+	errors      map[string]int64
+	rateLimited int64
+
+	sizeBuckets   []int64
+	requestSizes  map[string]*histogram
+	responseSizes map[string]*histogram
+}
+
+// NewCollector returns an empty collector with the default size buckets.
+func NewCollector() *Collector {
+	return &Collector{
+		requests:      make(map[string]int64),
+		errors:        make(map[string]int64),
+		sizeBuckets:   DefaultSizeBuckets,
+		requestSizes:  make(map[string]*histogram),
+		responseSizes: make(map[string]*histogram),
+	}
+}
+
+// SetSizeBuckets replaces the size-histogram bucket bounds. Call before any
+// observations land; the bounds are sorted so config order doesn't matter.
+func (c *Collector) SetSizeBuckets(bounds []int64) {
+	if len(bounds) == 0 {
+		return
+	}
+	sorted := append([]int64(nil), bounds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sizeBuckets = sorted
+	c.requestSizes = make(map[string]*histogram)
+	c.responseSizes = make(map[string]*histogram)
+}
+
+// RecordRequest counts a completed request for a service; 5xx statuses also
+// count as errors and 429s as rate-limit rejections.
+func (c *Collector) RecordRequest(service string, status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests[service]++
+	if status >= 500 {
+		c.errors[service]++
+	}
+	if status == 429 {
+		c.rateLimited++
+	}
+}
+
+// RecordSizes observes one request's body sizes for a service. Unlike the
+// interval counters, histograms accumulate for the life of the process —
+// capacity planning wants totals, not per-flush slices.
+func (c *Collector) RecordSizes(service string, requestBytes, responseBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.histogramLocked(c.requestSizes, service).observe(c.sizeBuckets, requestBytes)
+	c.histogramLocked(c.responseSizes, service).observe(c.sizeBuckets, responseBytes)
+}
+
+func (c *Collector) histogramLocked(m map[string]*histogram, service string) *histogram {
+	h, ok := m[service]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(c.sizeBuckets)+1)}
+		m[service] = h
+	}
+	return h
+}
+
+// HistogramSnapshot is the scrape form of one histogram: observation counts
+// keyed by bucket upper bound (bytes, "+Inf" for the overflow bucket), plus
+// the running sum and count.
+type HistogramSnapshot struct {
+	Buckets map[string]int64 `json:"buckets"`
+	Sum     int64            `json:"sum"`
+	Count   int64            `json:"count"`
+}
+
+// SizeSnapshot returns the size histograms for scraping, keyed metric name
+// then service.
+func (c *Collector) SizeSnapshot() map[string]map[string]HistogramSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return map[string]map[string]HistogramSnapshot{
+		"gateway_request_size_bytes":  c.snapshotSizesLocked(c.requestSizes),
+		"gateway_response_size_bytes": c.snapshotSizesLocked(c.responseSizes),
+	}
+}
+
+func (c *Collector) snapshotSizesLocked(m map[string]*histogram) map[string]HistogramSnapshot {
+	out := make(map[string]HistogramSnapshot, len(m))
+	for service, h := range m {
+		buckets := make(map[string]int64, len(h.counts))
+		for i, n := range h.counts {
+			label := "+Inf"
+			if i < len(c.sizeBuckets) {
+				label = strconv.FormatInt(c.sizeBuckets[i], 10)
+			}
+			buckets[label] = n
+		}
+		out[service] = HistogramSnapshot{Buckets: buckets, Sum: h.sum, Count: h.count}
+	}
+	return out
+}
+
+// histogram counts observations per bucket range; counts[i] covers values up
+// to and including sizeBuckets[i], with a final overflow bucket.
+type histogram struct {
+	counts []int64
+	sum    int64
+	count  int64
+}
+
+func (h *histogram) observe(buckets []int64, v int64) {
+	idx := len(buckets)
+	for i, upper := range buckets {
+		if v <= upper {
+			idx = i
+			break
+		}
+	}
+	h.counts[idx]++
+	h.sum += v
+	h.count++
+}
+
+// snapshot returns the counters accumulated since the last flush and resets
+// them, so each summary line covers one interval.
+func (c *Collector) snapshot() (requests, errors map[string]int64, rateLimited int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	requests, errors, rateLimited = c.requests, c.errors, c.rateLimited
+	c.requests = make(map[string]int64)
+	c.errors = make(map[string]int64)
+	c.rateLimited = 0
+	return requests, errors, rateLimited
+}
+
+// Reporter flushes a structured summary line every interval until stopped.
+type Reporter struct {
+	collector *Collector
+	interval  time.Duration
+
+	// breakerStates is polled at flush time so the summary reflects the
+	// live breaker state, not a counter.
+	breakerStates func() map[string]string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewReporter returns a reporter flushing the collector every interval.
+// breakerStates may be nil when there is nothing to report.
+func NewReporter(c *Collector, interval time.Duration, breakerStates func() map[string]string) *Reporter {
+	return &Reporter{
+		collector:     c,
+		interval:      interval,
+		breakerStates: breakerStates,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Start launches the flush loop in the background.
+func (r *Reporter) Start() {
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.flush()
+			case <-r.stop:
+				// One final flush so a shutdown doesn't drop the tail.
+				r.flush()
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the loop after a final flush and waits for it to exit.
+func (r *Reporter) Stop() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *Reporter) flush() {
+	requests, errors, rateLimited := r.collector.snapshot()
+	summary := map[string]interface{}{
+		"metrics":      true,
+		"requests":     requests,
+		"errors":       errors,
+		"rate_limited": rateLimited,
+	}
+	if r.breakerStates != nil {
+		summary["breakers"] = r.breakerStates()
+	}
+	if b, err := json.Marshal(summary); err == nil {
+		log.Println(string(b))
+	}
+}
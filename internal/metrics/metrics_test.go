@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReporterEmitsSummaryAfterInterval(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(log.Writer()) })
+
+	c := NewCollector()
+	c.RecordRequest("agent", 200)
+	c.RecordRequest("agent", 502)
+	c.RecordRequest("llm", 429)
+
+	r := NewReporter(c, 20*time.Millisecond, func() map[string]string {
+		return map[string]string{"agent": "closed"}
+	})
+	r.Start()
+	time.Sleep(50 * time.Millisecond)
+	r.Stop()
+
+	line := ""
+	for _, l := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(l, `"metrics":true`) {
+			line = l[strings.Index(l, "{"):]
+			break
+		}
+	}
+	if line == "" {
+		t.Fatal("no metrics summary line was emitted")
+	}
+
+	var summary struct {
+		Requests    map[string]int64  `json:"requests"`
+		Errors      map[string]int64  `json:"errors"`
+		RateLimited int64             `json:"rate_limited"`
+		Breakers    map[string]string `json:"breakers"`
+	}
+	if err := json.Unmarshal([]byte(line), &summary); err != nil {
+		t.Fatalf("summary is not valid JSON: %v", err)
+	}
+	if summary.Requests["agent"] != 2 || summary.Requests["llm"] != 1 {
+		t.Errorf("requests = %v, want agent:2 llm:1", summary.Requests)
+	}
+	if summary.Errors["agent"] != 1 {
+		t.Errorf("errors = %v, want agent:1", summary.Errors)
+	}
+	if summary.RateLimited != 1 {
+		t.Errorf("rate_limited = %d, want 1", summary.RateLimited)
+	}
+	if summary.Breakers["agent"] != "closed" {
+		t.Errorf("breakers = %v, want agent:closed", summary.Breakers)
+	}
+}
+
+func TestSizeHistogramBucketsObservations(t *testing.T) {
+	c := NewCollector()
+	c.SetSizeBuckets([]int64{100, 1000})
+
+	c.RecordSizes("agent", 50, 1500)
+	c.RecordSizes("agent", 120, 20)
+
+	snap := c.SizeSnapshot()
+	req := snap["gateway_request_size_bytes"]["agent"]
+	if req.Buckets["100"] != 1 || req.Buckets["1000"] != 1 || req.Buckets["+Inf"] != 0 {
+		t.Fatalf("request buckets = %v, want 50 in <=100 and 120 in <=1000", req.Buckets)
+	}
+	if req.Sum != 170 || req.Count != 2 {
+		t.Errorf("request sum/count = %d/%d, want 170/2", req.Sum, req.Count)
+	}
+	resp := snap["gateway_response_size_bytes"]["agent"]
+	if resp.Buckets["100"] != 1 || resp.Buckets["1000"] != 0 || resp.Buckets["+Inf"] != 1 {
+		t.Fatalf("response buckets = %v, want 20 in <=100 and 1500 overflowing", resp.Buckets)
+	}
+}
+
+func TestSizeHistogramDefaultBuckets(t *testing.T) {
+	c := NewCollector()
+	c.RecordSizes("llm", 3000, 500000)
+	snap := c.SizeSnapshot()
+	if got := snap["gateway_request_size_bytes"]["llm"].Buckets["4096"]; got != 1 {
+		t.Fatalf("3000-byte request landed outside the 4096 default bucket: %v",
+			snap["gateway_request_size_bytes"]["llm"].Buckets)
+	}
+	if got := snap["gateway_response_size_bytes"]["llm"].Buckets["1048576"]; got != 1 {
+		t.Fatalf("500000-byte response landed outside the 1048576 default bucket: %v",
+			snap["gateway_response_size_bytes"]["llm"].Buckets)
+	}
+}
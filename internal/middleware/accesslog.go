@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"os"
+	"strconv"
+	"sync"
+)
+
+// RotatingWriter is a size-rotating log file writer. When a write would push
+// the file past maxSize, the current file becomes <path>.1 (shifting older
+// backups up and dropping any beyond maxBackups) and a fresh file is opened.
+// Writes are serialized, so one access-log entry never straddles a rotation.
+type RotatingWriter struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewRotatingWriter opens (or creates) the log file at path, rotating it at
+// maxSize bytes and keeping maxBackups rotated files.
+func NewRotatingWriter(path string, maxSize int64, maxBackups int) (*RotatingWriter, error) {
+	w := &RotatingWriter{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *RotatingWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backup chain up by one and reopens a fresh file.
+func (w *RotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	for i := w.maxBackups - 1; i >= 1; i-- {
+		os.Rename(w.backupPath(i), w.backupPath(i+1))
+	}
+	if w.maxBackups > 0 {
+		if err := os.Rename(w.path, w.backupPath(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(w.path); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func (w *RotatingWriter) backupPath(i int) string {
+	return w.path + "." + strconv.Itoa(i)
+}
+
+// Close flushes and closes the current log file.
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+func TestRotatingWriterRotatesAndKeepsBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	w, err := NewRotatingWriter(path, 256, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter: %v", err)
+	}
+	defer w.Close()
+
+	cfg := &config.Config{}
+	handler := LoggingMiddlewareTo(cfg, w)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	for i := 0; i < 10; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/agent/run", nil))
+	}
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("expected backup file after rotation: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) > 3 {
+		t.Errorf("got %d files, want at most current + 2 backups", len(entries))
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading current log: %v", err)
+	}
+	if len(current) > 0 && !strings.Contains(string(current), `"path":"/api/agent/run"`) {
+		t.Errorf("current log missing expected entry: %q", current)
+	}
+}
+
+func TestRotatingWriterPreservesWholeLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	w, err := NewRotatingWriter(path, 100, 1)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter: %v", err)
+	}
+	defer w.Close()
+
+	line := strings.Repeat("x", 60) + "\n"
+	for i := 0; i < 4; i++ {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+
+	for _, p := range []string{path, path + ".1"} {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("reading %s: %v", p, err)
+		}
+		for _, got := range strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n") {
+			if got != line && got != strings.TrimSuffix(line, "\n") {
+				t.Errorf("%s contains a partial line %q", p, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+var adminKeyWarnOnce sync.Once
+
+// AdminKeyValid reports whether the request carries an X-Admin-Key matching
+// the configured ADMIN_API_KEY, compared in constant time. An unset key
+// never validates — callers granting privileged behavior must not treat an
+// unconfigured deployment as trusted.
+func AdminKeyValid(r *http.Request, cfg *config.Config) bool {
+	if cfg.AdminAPIKey == "" {
+		return false
+	}
+	key := r.Header.Get("X-Admin-Key")
+	return subtle.ConstantTimeCompare([]byte(key), []byte(cfg.AdminAPIKey)) == 1
+}
+
+// AdminAuthMiddleware gates the /gateway/* admin routes behind an X-Admin-Key
+// header matching ADMIN_API_KEY, compared in constant time. When no key is
+// configured the routes stay open (handy for local dev), with a warning logged
+// once so it doesn't go unnoticed in production.
+func AdminAuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.AdminAPIKey == "" {
+				adminKeyWarnOnce.Do(func() {
+					log.Println("ADMIN_API_KEY is not set; /gateway/* admin endpoints are unauthenticated")
+				})
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !AdminKeyValid(r, cfg) {
+				writeAuthError(w, http.StatusUnauthorized, "invalid admin key")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
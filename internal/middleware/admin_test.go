@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+func adminProbe(t *testing.T, cfg *config.Config, key string) int {
+	t.Helper()
+	handler := AdminAuthMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/gateway/circuit-breaker/state", nil)
+	if key != "" {
+		req.Header.Set("X-Admin-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestAdminAuthCorrectKey(t *testing.T) {
+	cfg := &config.Config{AdminAPIKey: "s3cret"}
+	if got := adminProbe(t, cfg, "s3cret"); got != http.StatusOK {
+		t.Fatalf("correct key: got status %d, want 200", got)
+	}
+}
+
+func TestAdminAuthWrongKey(t *testing.T) {
+	cfg := &config.Config{AdminAPIKey: "s3cret"}
+	if got := adminProbe(t, cfg, "wrong"); got != http.StatusUnauthorized {
+		t.Fatalf("wrong key: got status %d, want 401", got)
+	}
+	if got := adminProbe(t, cfg, ""); got != http.StatusUnauthorized {
+		t.Fatalf("missing key: got status %d, want 401", got)
+	}
+}
+
+func TestAdminAuthUnsetKeyPassesThrough(t *testing.T) {
+	cfg := &config.Config{}
+	if got := adminProbe(t, cfg, ""); got != http.StatusOK {
+		t.Fatalf("unset ADMIN_API_KEY: got status %d, want 200", got)
+	}
+}
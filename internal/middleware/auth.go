@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+type contextKey string
+
+// userIDKey is the context key under which the resolved user ID is stored.
+const userIDKey contextKey = "userID"
+
+// claimsKey is the context key under which verified JWT claims are stored.
+const claimsKey contextKey = "claims"
+
+// GetUserID returns the user ID resolved by AuthMiddleware, or "" when the
+// middleware did not run.
+func GetUserID(r *http.Request) string {
+	if id, ok := r.Context().Value(userIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// AuthMiddleware resolves the caller's identity. When a Supabase JWT secret
+// is configured, a Bearer token is verified and its subject becomes the user
+// ID. Without a secret the gateway trusts an X-User-ID header. An X-API-Key
+// matching a configured API_KEYS entry resolves to its tenant when no JWT
+// identity was established, and the final fallback is an anonymous ID
+// derived from the remote address.
+func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Public routes (health probes and friends) are unauthenticated.
+			if isPublicPath(r, cfg) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userID := ""
+			if cfg.SupabaseJWTSecret != "" {
+				token := bearerToken(r)
+				if token == "" {
+					// With verification active a client-supplied X-User-ID is
+					// never identity; strip it so it can't reach backends or
+					// influence rate limiting.
+					r.Header.Del("X-User-ID")
+				}
+				if token != "" {
+					claims, err := parseJWT(token, cfg.SupabaseJWTSecret)
+					if err != nil {
+						writeAuthError(w, http.StatusUnauthorized, "invalid token")
+						return
+					}
+					if sub, ok := claims["sub"].(string); ok {
+						userID = sub
+					}
+					r = r.WithContext(context.WithValue(r.Context(), claimsKey, claims))
+					// A disagreeing X-User-ID header alongside a valid JWT
+					// smells like an impersonation attempt. The JWT always
+					// wins; the header is overwritten below.
+					if hdr := r.Header.Get("X-User-ID"); hdr != "" && userID != "" && hdr != userID {
+						log.Printf("identity conflict: JWT subject %q vs X-User-ID %q from %s", userID, hdr, ClientIP(r, cfg))
+						if cfg.RejectIdentityConflict {
+							writeAuthError(w, http.StatusUnauthorized, "conflicting identity")
+							return
+						}
+					}
+				}
+			} else if hdr := r.Header.Get("X-User-ID"); hdr != "" {
+				userID = hdr
+			}
+
+			// Static API keys rank below a verified JWT but above anonymous.
+			if userID == "" && len(cfg.APIKeys) > 0 {
+				if tenant, ok := cfg.APIKeys[r.Header.Get("X-API-Key")]; ok {
+					userID = tenant
+				}
+			}
+
+			if userID == "" {
+				userID = anonymousID(w, r, cfg)
+			}
+
+			// Forward the resolved identity to upstreams.
+			r.Header.Set("X-User-ID", userID)
+
+			ctx := context.WithValue(r.Context(), userIDKey, userID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// anonCookieName is the gateway-issued session cookie identifying
+// anonymous callers under the session-cookie strategy.
+const anonCookieName = "gw_anon"
+
+// anonymousID builds a stable identity for an unauthenticated caller
+// according to ANONYMOUS_ID_STRATEGY. Every strategy yields an
+// "anonymous-" prefixed ID so the rate limiter's anonymous tier still
+// applies.
+func anonymousID(w http.ResponseWriter, r *http.Request, cfg *config.Config) string {
+	switch cfg.AnonymousIDStrategy {
+	case "session-cookie":
+		if c, err := r.Cookie(anonCookieName); err == nil && c.Value != "" {
+			return "anonymous-" + c.Value
+		}
+		id := newRequestID()
+		cookie := &http.Cookie{
+			Name:     anonCookieName,
+			Value:    id,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+			Secure:   cfg.AnonCookieSecure,
+			Domain:   cfg.AnonCookieDomain,
+		}
+		if cfg.AnonCookieMaxAge > 0 {
+			cookie.MaxAge = int(cfg.AnonCookieMaxAge.Seconds())
+		}
+		http.SetCookie(w, cookie)
+		return "anonymous-" + id
+	case "header-hash":
+		// Hashing UA+IP keeps distinct clients behind one NAT apart
+		// without leaking either value to backends or logs.
+		sum := sha256.Sum256([]byte(r.Header.Get("User-Agent") + "|" + ClientIP(r, cfg)))
+		return "anonymous-" + hex.EncodeToString(sum[:8])
+	default: // "ip"
+		// Key anonymous users by the resolved client IP so everyone
+		// behind a shared load balancer doesn't collapse into one
+		// identity.
+		return "anonymous-" + strings.ReplaceAll(ClientIP(r, cfg), ":", "-")
+	}
+}
+
+// GetClaims returns the verified JWT claims stored by AuthMiddleware, or
+// nil when the request carried no valid JWT.
+func GetClaims(r *http.Request) map[string]interface{} {
+	if claims, ok := r.Context().Value(claimsKey).(map[string]interface{}); ok {
+		return claims
+	}
+	return nil
+}
+
+// RequireClaim returns a middleware allowing only requests whose verified
+// JWT carries the given claim with the given value; anonymous callers and
+// mismatched claims get a 403. Apply it to subrouters that need role-based
+// authorization, after AuthMiddleware.
+func RequireClaim(claim, value string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetClaims(r)
+			if got, ok := claims[claim].(string); !ok || got != value {
+				writeAuthError(w, http.StatusForbidden, "forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+func writeAuthError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(`{"error":"` + msg + `"}`))
+}
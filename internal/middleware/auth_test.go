@@ -0,0 +1,320 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// resolveUserID runs AuthMiddleware over a request and returns the user ID
+// the downstream handler observed.
+func resolveUserID(t *testing.T, cfg *config.Config, mutate func(*http.Request)) string {
+	t.Helper()
+	var got string
+	handler := AuthMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetUserID(r)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/run", nil)
+	if mutate != nil {
+		mutate(req)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	return got
+}
+
+func TestAuthResolvesAPIKeyToTenant(t *testing.T) {
+	cfg := &config.Config{APIKeys: map[string]string{"key1": "tenantA", "key2": "tenantB"}}
+	got := resolveUserID(t, cfg, func(r *http.Request) {
+		r.Header.Set("X-API-Key", "key2")
+	})
+	if got != "tenantB" {
+		t.Fatalf("user ID = %q, want tenantB", got)
+	}
+}
+
+func TestAuthUnknownAPIKeyFallsThroughToAnonymous(t *testing.T) {
+	cfg := &config.Config{APIKeys: map[string]string{"key1": "tenantA"}}
+	got := resolveUserID(t, cfg, func(r *http.Request) {
+		r.Header.Set("X-API-Key", "nope")
+	})
+	if !strings.HasPrefix(got, "anonymous-") {
+		t.Fatalf("user ID = %q, want anonymous fallback", got)
+	}
+}
+
+func requireClaimProbe(t *testing.T, claims map[string]interface{}) int {
+	t.Helper()
+	handler := RequireClaim("role", "admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/admin", nil)
+	if claims != nil {
+		req = req.WithContext(context.WithValue(req.Context(), claimsKey, claims))
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestRequireClaimAllowsMatchingRole(t *testing.T) {
+	if got := requireClaimProbe(t, map[string]interface{}{"role": "admin"}); got != http.StatusOK {
+		t.Fatalf("admin token: got status %d, want 200", got)
+	}
+}
+
+func TestRequireClaimForbidsMismatch(t *testing.T) {
+	if got := requireClaimProbe(t, map[string]interface{}{"role": "user"}); got != http.StatusForbidden {
+		t.Fatalf("non-admin token: got status %d, want 403", got)
+	}
+}
+
+func TestRequireClaimForbidsAnonymous(t *testing.T) {
+	if got := requireClaimProbe(t, nil); got != http.StatusForbidden {
+		t.Fatalf("anonymous request: got status %d, want 403", got)
+	}
+}
+
+// signTestJWT builds an HS256 token the way Supabase does, for exercising
+// the verification path.
+func signTestJWT(t *testing.T, secret string, claims map[string]interface{}) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	body := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthStoresClaimsInContext(t *testing.T) {
+	cfg := &config.Config{SupabaseJWTSecret: "test-secret"}
+	token := signTestJWT(t, "test-secret", map[string]interface{}{
+		"sub":   "user-1",
+		"email": "dev@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+
+	var claims map[string]interface{}
+	handler := AuthMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims = GetClaims(r)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/run", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if claims == nil {
+		t.Fatal("GetClaims returned nil for a verified token")
+	}
+	if got, _ := claims["email"].(string); got != "dev@example.com" {
+		t.Errorf("email claim = %q, want dev@example.com", got)
+	}
+}
+
+func TestIdentityConflictPrefersJWTAndLogs(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(log.Writer()) })
+
+	cfg := &config.Config{SupabaseJWTSecret: "test-secret"}
+	token := signTestJWT(t, "test-secret", map[string]interface{}{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	got := resolveUserID(t, cfg, func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("X-User-ID", "someone-else")
+	})
+	if got != "user-1" {
+		t.Fatalf("user ID = %q, want the JWT subject user-1", got)
+	}
+	if !strings.Contains(buf.String(), "identity conflict") {
+		t.Error("conflicting X-User-ID was not logged")
+	}
+}
+
+func TestIdentityConflictRejectsWhenConfigured(t *testing.T) {
+	cfg := &config.Config{SupabaseJWTSecret: "test-secret", RejectIdentityConflict: true}
+	token := signTestJWT(t, "test-secret", map[string]interface{}{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	handler := AuthMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/run", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-User-ID", "someone-else")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want 401", rec.Code)
+	}
+}
+
+func anonID(t *testing.T, cfg *config.Config, prep func(*http.Request)) (string, *httptest.ResponseRecorder) {
+	t.Helper()
+	var id string
+	handler := AuthMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = GetUserID(r)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/x", nil)
+	req.RemoteAddr = "203.0.113.7:12345"
+	if prep != nil {
+		prep(req)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return id, rec
+}
+
+func TestAnonymousStrategyIP(t *testing.T) {
+	cfg := &config.Config{AnonymousIDStrategy: "ip"}
+	first, _ := anonID(t, cfg, nil)
+	second, _ := anonID(t, cfg, nil)
+	if first != "anonymous-203.0.113.7" {
+		t.Errorf("ip strategy ID = %q, want anonymous-203.0.113.7 (no port)", first)
+	}
+	if first != second {
+		t.Errorf("ip strategy unstable: %q then %q", first, second)
+	}
+}
+
+func TestAnonymousStrategyHeaderHash(t *testing.T) {
+	cfg := &config.Config{AnonymousIDStrategy: "header-hash"}
+	ua := func(r *http.Request) { r.Header.Set("User-Agent", "test-agent/1.0") }
+	first, _ := anonID(t, cfg, ua)
+	second, _ := anonID(t, cfg, ua)
+	if first != second {
+		t.Errorf("header-hash unstable for same UA+IP: %q then %q", first, second)
+	}
+	if strings.Contains(first, "203.0.113.7") {
+		t.Errorf("header-hash leaks the IP: %q", first)
+	}
+	other, _ := anonID(t, cfg, func(r *http.Request) { r.Header.Set("User-Agent", "other/2.0") })
+	if other == first {
+		t.Error("different User-Agent should hash to a different ID")
+	}
+}
+
+func TestAnonymousStrategySessionCookie(t *testing.T) {
+	cfg := &config.Config{AnonymousIDStrategy: "session-cookie"}
+	first, rec := anonID(t, cfg, nil)
+
+	cookies := (&http.Response{Header: rec.Header()}).Cookies()
+	var issued *http.Cookie
+	for _, c := range cookies {
+		if c.Name == "gw_anon" {
+			issued = c
+		}
+	}
+	if issued == nil {
+		t.Fatal("first anonymous request did not set gw_anon")
+	}
+	if !issued.HttpOnly || issued.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie attributes = %+v, want HttpOnly SameSite=Lax", issued)
+	}
+	if first != "anonymous-"+issued.Value {
+		t.Errorf("ID %q does not match issued cookie %q", first, issued.Value)
+	}
+
+	second, rec2 := anonID(t, cfg, func(r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: "gw_anon", Value: issued.Value})
+	})
+	if second != first {
+		t.Errorf("cookie-bearing request got ID %q, want reuse of %q", second, first)
+	}
+	if len(rec2.Header().Values("Set-Cookie")) != 0 {
+		t.Error("follow-up request should not re-issue the cookie")
+	}
+}
+
+func TestAnonCookieAttributesConfigurable(t *testing.T) {
+	cfg := &config.Config{
+		AnonymousIDStrategy: "session-cookie",
+		AnonCookieSecure:    true,
+		AnonCookieDomain:    "api.example.com",
+		AnonCookieMaxAge:    24 * time.Hour,
+	}
+	_, rec := anonID(t, cfg, nil)
+
+	var issued *http.Cookie
+	for _, c := range (&http.Response{Header: rec.Header()}).Cookies() {
+		if c.Name == "gw_anon" {
+			issued = c
+		}
+	}
+	if issued == nil {
+		t.Fatal("gw_anon cookie not set")
+	}
+	if !issued.Secure {
+		t.Error("cookie should be Secure")
+	}
+	if issued.Domain != "api.example.com" {
+		t.Errorf("cookie Domain = %q, want api.example.com", issued.Domain)
+	}
+	if issued.MaxAge != int((24 * time.Hour).Seconds()) {
+		t.Errorf("cookie MaxAge = %d, want %d", issued.MaxAge, int((24 * time.Hour).Seconds()))
+	}
+}
+
+func TestAnonCookieNotIssuedForIdentifiedUsers(t *testing.T) {
+	cfg := &config.Config{AnonymousIDStrategy: "session-cookie"}
+	_, rec := anonID(t, cfg, func(r *http.Request) {
+		r.Header.Set("X-User-ID", "user-42")
+	})
+	if len(rec.Header().Values("Set-Cookie")) != 0 {
+		t.Error("identified user should not receive a gw_anon cookie")
+	}
+}
+
+func TestSpoofedUserIDOverwrittenByJWTSubject(t *testing.T) {
+	secret := "test-secret"
+	cfg := &config.Config{SupabaseJWTSecret: secret}
+
+	var forwarded string
+	handler := AuthMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("X-User-ID")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/x", nil)
+	req.Header.Set("Authorization", "Bearer "+signTestJWT(t, secret, map[string]interface{}{"sub": "real-user"}))
+	req.Header.Set("X-User-ID", "admin")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if forwarded != "real-user" {
+		t.Fatalf("backend saw X-User-ID %q, want JWT subject real-user", forwarded)
+	}
+}
+
+func TestSpoofedUserIDStrippedWithoutToken(t *testing.T) {
+	cfg := &config.Config{SupabaseJWTSecret: "test-secret"}
+
+	var forwarded, resolved string
+	handler := AuthMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("X-User-ID")
+		resolved = GetUserID(r)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/x", nil)
+	req.Header.Set("X-User-ID", "admin")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if forwarded == "admin" || resolved == "admin" {
+		t.Fatalf("spoofed header survived: forwarded %q, resolved %q", forwarded, resolved)
+	}
+	if !strings.HasPrefix(resolved, "anonymous-") {
+		t.Fatalf("tokenless caller resolved to %q, want anonymous identity", resolved)
+	}
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// captureReader tees the first limit bytes of a request body while the
+// proxy consumes it, leaving the stream itself untouched.
+type captureReader struct {
+	io.ReadCloser
+	buf   bytes.Buffer
+	limit int
+}
+
+func (c *captureReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 {
+		if remaining := c.limit - c.buf.Len(); remaining > 0 {
+			if n <= remaining {
+				c.buf.Write(p[:n])
+			} else {
+				c.buf.Write(p[:remaining])
+			}
+		}
+	}
+	return n, err
+}
+
+// captureWriter tees the first limit bytes of the response body on its way
+// to the client.
+type captureWriter struct {
+	*ResponseRecorder
+	buf   bytes.Buffer
+	limit int
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if remaining := c.limit - c.buf.Len(); remaining > 0 {
+		if len(b) <= remaining {
+			c.buf.Write(b)
+		} else {
+			c.buf.Write(b[:remaining])
+		}
+	}
+	return c.ResponseRecorder.Write(b)
+}
+
+// BodyLogMiddleware, when DEBUG_BODY_LOGGING is on, logs size-capped
+// request and response body snippets for 5xx responses only. Bodies are
+// tee'd, never consumed, so proxying is unaffected. Values of JSON fields
+// named in DEBUG_BODY_REDACT are masked before logging. Services marked
+// <NAME>_LOG_REDACT are exempt per service: their bodies are never
+// captured, overriding the global toggle.
+func BodyLogMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	redact := redactPattern(cfg.DebugBodyRedactFields)
+	limit := cfg.DebugBodyMaxBytes
+	if limit <= 0 {
+		limit = 2048
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if name := serviceFromPath(r.URL.Path); name != "" {
+				if svc, ok := cfg.Services[name]; ok && svc.LogRedact {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			reqCap := &captureReader{ReadCloser: r.Body, limit: limit}
+			r.Body = reqCap
+			respCap := &captureWriter{ResponseRecorder: NewResponseRecorder(w), limit: limit}
+			next.ServeHTTP(respCap, r)
+
+			if respCap.Status() < http.StatusInternalServerError {
+				return
+			}
+			entry := map[string]interface{}{
+				"body_debug":    true,
+				"request_id":    GetRequestID(r),
+				"path":          r.URL.Path,
+				"status":        respCap.Status(),
+				"request_body":  redactBody(reqCap.buf.String(), redact),
+				"response_body": redactBody(respCap.buf.String(), redact),
+			}
+			if b, err := json.Marshal(entry); err == nil {
+				log.Println(string(b))
+			}
+		})
+	}
+}
+
+// redactPattern compiles a matcher for the string values of the named JSON
+// fields; nil when no fields are configured.
+func redactPattern(fields []string) *regexp.Regexp {
+	if len(fields) == 0 {
+		return nil
+	}
+	alts := ""
+	for i, f := range fields {
+		if i > 0 {
+			alts += "|"
+		}
+		alts += regexp.QuoteMeta(f)
+	}
+	return regexp.MustCompile(`("(?:` + alts + `)"\s*:\s*)"[^"]*"`)
+}
+
+// redactBody masks configured field values in a captured snippet.
+func redactBody(body string, redact *regexp.Regexp) string {
+	if redact == nil {
+		return body
+	}
+	return redact.ReplaceAllString(body, `$1"[redacted]"`)
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+func TestBodyLoggingCapturesBodiesFor5xx(t *testing.T) {
+	buf := captureLog(t)
+
+	cfg := &config.Config{DebugBodyLogging: true, DebugBodyMaxBytes: 2048,
+		DebugBodyRedactFields: []string{"password"}}
+	var backendSaw string
+	handler := BodyLogMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		backendSaw = string(b)
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"error":"upstream exploded"}`))
+	}))
+
+	body := `{"prompt":"hello","password":"hunter2"}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/llm/generate", strings.NewReader(body)))
+
+	if backendSaw != body {
+		t.Fatalf("backend saw %q, want the intact body", backendSaw)
+	}
+	if rec.Body.String() != `{"error":"upstream exploded"}` {
+		t.Fatalf("client response altered: %q", rec.Body.String())
+	}
+
+	logged := buf.String()
+	if !strings.Contains(logged, `\"prompt\":\"hello\"`) && !strings.Contains(logged, `"prompt"`) {
+		t.Errorf("request body snippet missing from log: %s", logged)
+	}
+	if !strings.Contains(logged, "upstream exploded") {
+		t.Errorf("response body snippet missing from log: %s", logged)
+	}
+	if strings.Contains(logged, "hunter2") {
+		t.Errorf("redacted field value leaked: %s", logged)
+	}
+	if !strings.Contains(logged, "[redacted]") {
+		t.Errorf("redaction marker missing: %s", logged)
+	}
+}
+
+func TestBodyLoggingSkips2xx(t *testing.T) {
+	buf := captureLog(t)
+
+	cfg := &config.Config{DebugBodyLogging: true}
+	handler := BodyLogMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("fine"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/api/agent/run", strings.NewReader("payload")))
+
+	if strings.Contains(buf.String(), "body_debug") {
+		t.Fatalf("2xx response produced a body-debug entry: %s", buf.String())
+	}
+}
+
+func TestBodyLoggingCapsSnippetSize(t *testing.T) {
+	buf := captureLog(t)
+
+	cfg := &config.Config{DebugBodyLogging: true, DebugBodyMaxBytes: 10}
+	handler := BodyLogMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(strings.Repeat("y", 100)))
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/agent/run",
+		strings.NewReader(strings.Repeat("x", 100))))
+
+	if rec.Body.Len() != 100 {
+		t.Fatalf("client got %d bytes, want the full 100", rec.Body.Len())
+	}
+	if strings.Contains(buf.String(), strings.Repeat("x", 11)) ||
+		strings.Contains(buf.String(), strings.Repeat("y", 11)) {
+		t.Fatalf("snippet exceeds the configured cap: %s", buf.String())
+	}
+}
+
+func TestBodyLoggingSkipsRedactedServices(t *testing.T) {
+	buf := captureLog(t)
+
+	cfg := &config.Config{
+		DebugBodyLogging: true,
+		Services: map[string]*config.ServiceConfig{
+			"llm":   {Name: "llm", LogRedact: true},
+			"agent": {Name: "agent"},
+		},
+	}
+	handler := BodyLogMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"error":"boom"}`))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(
+		http.MethodPost, "/api/llm/generate", strings.NewReader(`{"prompt":"secret plans"}`)))
+	if logged := buf.String(); strings.Contains(logged, "secret plans") {
+		t.Fatalf("redacted service's body reached the log: %s", logged)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(
+		http.MethodPost, "/api/agent/run", strings.NewReader(`{"task":"visible"}`)))
+	if logged := buf.String(); !strings.Contains(logged, "visible") {
+		t.Fatalf("unredacted service's body missing from the log: %s", logged)
+	}
+}
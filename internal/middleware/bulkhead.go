@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// Bulkhead caps how many requests may be in flight at once gateway-wide, so
+// a burst of expensive LLM calls can't exhaust goroutines and descriptors.
+type Bulkhead struct {
+	sem chan struct{}
+
+	// waiting counts requests queued for a slot.
+	waiting atomic.Int64
+}
+
+// NewBulkhead returns a bulkhead admitting at most max concurrent requests.
+func NewBulkhead(max int) *Bulkhead {
+	return &Bulkhead{sem: make(chan struct{}, max)}
+}
+
+// Acquire claims a slot without blocking, reporting false when the bulkhead
+// is full or the request context is already done. Callers must Release on
+// true.
+func (b *Bulkhead) Acquire(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case b.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// AcquireWait claims a slot, queuing for up to wait when the bulkhead is
+// full. It reports false when the wait elapses or the client goes away
+// first; a zero wait degenerates to the non-blocking Acquire.
+func (b *Bulkhead) AcquireWait(ctx context.Context, wait time.Duration) bool {
+	if b.Acquire(ctx) {
+		return true
+	}
+	if wait <= 0 {
+		return false
+	}
+	b.waiting.Add(1)
+	defer b.waiting.Add(-1)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case b.sem <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Release returns a slot claimed by Acquire.
+func (b *Bulkhead) Release() {
+	<-b.sem
+}
+
+// InFlight reports how many slots are currently claimed.
+func (b *Bulkhead) InFlight() int {
+	return len(b.sem)
+}
+
+// QueueDepth reports how many requests are currently waiting for a slot.
+func (b *Bulkhead) QueueDepth() int {
+	return int(b.waiting.Load())
+}
+
+// BulkheadMiddleware enforces the MAX_CONCURRENT_REQUESTS cap. Requests
+// queue for up to QUEUE_WAIT_TIMEOUT for a slot before getting 503 with a
+// Retry-After hint, which smooths short bursts. Health probes bypass it so
+// a saturated gateway still reports liveness.
+func BulkheadMiddleware(cfg *config.Config, b *Bulkhead) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPublicPath(r, cfg) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !b.AcquireWait(r.Context(), cfg.QueueWaitTimeout) {
+				w.Header().Set("Retry-After", strconv.Itoa(concurrencyRetryAfterSeconds(cfg)))
+				writeAuthError(w, http.StatusServiceUnavailable, "gateway at capacity")
+				return
+			}
+			defer b.Release()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
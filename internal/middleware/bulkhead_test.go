@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+func TestBulkheadRejectsWhenSaturated(t *testing.T) {
+	cfg := &config.Config{PublicPaths: []string{"/health", "/ready"}}
+	b := NewBulkhead(2)
+	mw := BulkheadMiddleware(cfg, b)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	blocking := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	instant := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blocking.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil))
+		}()
+	}
+	<-started
+	<-started
+
+	rec := httptest.NewRecorder()
+	instant.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("saturated: got status %d, want 503", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("saturated rejection is missing Retry-After")
+	}
+
+	// Health probes bypass the bulkhead entirely.
+	rec = httptest.NewRecorder()
+	instant.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("health probe under saturation: got status %d, want 200", rec.Code)
+	}
+
+	close(release)
+	wg.Wait()
+
+	// A freed slot admits new traffic again.
+	rec = httptest.NewRecorder()
+	instant.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("after release: got status %d, want 200", rec.Code)
+	}
+}
+
+func TestBulkheadQueueWaits(t *testing.T) {
+	cfg := &config.Config{QueueWaitTimeout: time.Second}
+	b := NewBulkhead(1)
+	mw := BulkheadMiddleware(cfg, b)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	blocking := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	go blocking.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil))
+	<-started
+
+	// The queued request waits out the holder and then succeeds.
+	done := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(
+			rec, httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil))
+		done <- rec.Code
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if depth := b.QueueDepth(); depth != 1 {
+		t.Errorf("queue depth while waiting = %d, want 1", depth)
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("queued request: got status %d, want 200", code)
+	}
+}
+
+func TestBulkheadQueueTimesOut(t *testing.T) {
+	cfg := &config.Config{QueueWaitTimeout: 30 * time.Millisecond}
+	b := NewBulkhead(1)
+	mw := BulkheadMiddleware(cfg, b)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	blocking := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	go blocking.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil))
+	<-started
+	defer close(release)
+
+	rec := httptest.NewRecorder()
+	mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(
+		rec, httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("timed-out queue wait: got status %d, want 503", rec.Code)
+	}
+}
+
+func TestBulkheadQueueRespectsClientCancel(t *testing.T) {
+	cfg := &config.Config{QueueWaitTimeout: time.Minute}
+	b := NewBulkhead(1)
+	mw := BulkheadMiddleware(cfg, b)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	blocking := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	go blocking.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil))
+	<-started
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil).WithContext(ctx)
+	done := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, req)
+		done <- rec.Code
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case code := <-done:
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("cancelled queue wait: got status %d, want 503", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelled request did not return promptly")
+	}
+}
@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// cacheEntry is one stored response plus its expiry.
+type cacheEntry struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// ResponseCache is an LRU cache of whole responses, keyed by
+// method+path+query+user so one user's view is never served to another.
+type ResponseCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // front is most recently used
+	max     int
+	ttl     time.Duration
+}
+
+// NewResponseCache returns a cache holding at most max entries with the
+// given default TTL.
+func NewResponseCache(max int, ttl time.Duration) *ResponseCache {
+	return &ResponseCache{
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		max:     max,
+		ttl:     ttl,
+	}
+}
+
+// get returns a live entry, promoting it; expired entries are evicted.
+func (c *ResponseCache) get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return entry
+}
+
+// put stores an entry with the given TTL, evicting the least recently used
+// entry when full.
+func (c *ResponseCache) put(key string, entry *cacheEntry, ttl time.Duration) {
+	entry.key = key
+	entry.expires = time.Now().Add(ttl)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	if c.lru.Len() >= c.max {
+		if oldest := c.lru.Back(); oldest != nil {
+			c.lru.Remove(oldest)
+			delete(c.entries, oldest.Value.(*cacheEntry).key)
+		}
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+}
+
+// maxRecordedBodyBytes caps how much response body a recorder buffers; a
+// response that grows past it streams through unrecorded rather than holding
+// an arbitrarily large copy in memory.
+const maxRecordedBodyBytes = 1 << 20
+
+// cacheRecorder tees the response to the client while buffering it for
+// replay. Recording is abandoned — the response still reaches the client —
+// when the body outgrows maxBody, when the connection is hijacked, or, with
+// skipStreaming set, when the response turns out to be a stream (an event
+// stream, or anything the handler flushes incrementally).
+type cacheRecorder struct {
+	http.ResponseWriter
+	status        int
+	maxBody       int
+	skipStreaming bool
+	skipped       bool
+	buf           bytes.Buffer
+}
+
+func (cr *cacheRecorder) WriteHeader(status int) {
+	cr.status = status
+	if cr.skipStreaming && strings.HasPrefix(cr.Header().Get("Content-Type"), "text/event-stream") {
+		cr.skip()
+	}
+	cr.ResponseWriter.WriteHeader(status)
+}
+
+func (cr *cacheRecorder) Write(b []byte) (int, error) {
+	if !cr.skipped {
+		cr.buf.Write(b)
+		if cr.maxBody > 0 && cr.buf.Len() > cr.maxBody {
+			cr.skip()
+		}
+	}
+	return cr.ResponseWriter.Write(b)
+}
+
+// skip abandons recording and releases what was buffered so far.
+func (cr *cacheRecorder) skip() {
+	cr.skipped = true
+	cr.buf.Reset()
+}
+
+// Flush forwards to the underlying writer when it supports flushing. A
+// flushed response is being delivered incrementally, so with skipStreaming
+// set its final length is unknowable and recording stops.
+func (cr *cacheRecorder) Flush() {
+	if cr.skipStreaming {
+		cr.skip()
+	}
+	if f, ok := cr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack forwards to the underlying writer when it supports hijacking; a
+// taken-over connection has no recordable response.
+func (cr *cacheRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := cr.ResponseWriter.(http.Hijacker); ok {
+		cr.skip()
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap exposes the wrapped writer so http.ResponseController can reach
+// the connection's deadline controls.
+func (cr *cacheRecorder) Unwrap() http.ResponseWriter { return cr.ResponseWriter }
+
+// CacheMiddleware serves repeat GET lookups from the LRU cache, marking
+// responses X-Cache: HIT or MISS. Only 200 responses to /api/ GETs without a
+// no-store directive are stored; an upstream max-age overrides CACHE_TTL.
+func CacheMiddleware(cfg *config.Config, cache *ResponseCache) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, "/api/") ||
+				strings.Contains(r.Header.Get("Cache-Control"), "no-store") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user := GetUserID(r)
+			if user == "" {
+				user = "anonymous"
+			}
+			key := r.Method + "|" + r.URL.Path + "?" + r.URL.RawQuery + "|" + user
+
+			if entry := cache.get(key); entry != nil {
+				for name, values := range entry.header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("X-Cache", "HIT")
+				w.WriteHeader(entry.status)
+				w.Write(entry.body)
+				return
+			}
+
+			w.Header().Set("X-Cache", "MISS")
+			cr := &cacheRecorder{
+				ResponseWriter: w,
+				status:         http.StatusOK,
+				maxBody:        maxRecordedBodyBytes,
+				skipStreaming:  true,
+			}
+			next.ServeHTTP(cr, r)
+
+			cc := cr.Header().Get("Cache-Control")
+			if cr.skipped || cr.status != http.StatusOK || strings.Contains(cc, "no-store") {
+				return
+			}
+			ttl := cfg.CacheTTL
+			if maxAge := parseMaxAge(cc); maxAge > 0 {
+				ttl = maxAge
+			}
+			header := make(http.Header, len(cr.Header()))
+			for name, values := range cr.Header() {
+				if name == "X-Cache" {
+					continue
+				}
+				header[name] = append([]string(nil), values...)
+			}
+			cache.put(key, &cacheEntry{
+				status: cr.status,
+				header: header,
+				body:   append([]byte(nil), cr.buf.Bytes()...),
+			}, ttl)
+		})
+	}
+}
+
+// parseMaxAge extracts a max-age directive in seconds; zero means absent or
+// unusable.
+func parseMaxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if value, ok := strings.CutPrefix(directive, "max-age="); ok {
+			if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+				return time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// countingBackend returns a handler whose body includes how many times it
+// has been invoked, so cache hits are distinguishable from fresh fetches.
+func countingBackend() (http.Handler, *int) {
+	calls := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("call-" + strconv.Itoa(calls)))
+	}), &calls
+}
+
+func cachedGet(handler http.Handler, path, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if user != "" {
+		req = req.WithContext(contextWithUserID(req, user))
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCacheHitAndMiss(t *testing.T) {
+	cfg := &config.Config{CacheTTL: time.Minute}
+	backend, calls := countingBackend()
+	handler := CacheMiddleware(cfg, NewResponseCache(10, cfg.CacheTTL))(backend)
+
+	rec := cachedGet(handler, "/api/rag/lookup?q=x", "user-1")
+	if got := rec.Header().Get("X-Cache"); got != "MISS" {
+		t.Fatalf("first request X-Cache = %q, want MISS", got)
+	}
+
+	rec = cachedGet(handler, "/api/rag/lookup?q=x", "user-1")
+	if got := rec.Header().Get("X-Cache"); got != "HIT" {
+		t.Fatalf("second request X-Cache = %q, want HIT", got)
+	}
+	if rec.Body.String() != "call-1" {
+		t.Errorf("hit body = %q, want the cached call-1", rec.Body.String())
+	}
+	if *calls != 1 {
+		t.Errorf("backend called %d times, want 1", *calls)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	cfg := &config.Config{CacheTTL: 30 * time.Millisecond}
+	backend, calls := countingBackend()
+	handler := CacheMiddleware(cfg, NewResponseCache(10, cfg.CacheTTL))(backend)
+
+	cachedGet(handler, "/api/rag/lookup", "user-1")
+	time.Sleep(50 * time.Millisecond)
+	rec := cachedGet(handler, "/api/rag/lookup", "user-1")
+	if got := rec.Header().Get("X-Cache"); got != "MISS" {
+		t.Fatalf("post-expiry X-Cache = %q, want MISS", got)
+	}
+	if *calls != 2 {
+		t.Errorf("backend called %d times, want 2", *calls)
+	}
+}
+
+func TestCacheIsolatesUsers(t *testing.T) {
+	cfg := &config.Config{CacheTTL: time.Minute}
+	backend, _ := countingBackend()
+	handler := CacheMiddleware(cfg, NewResponseCache(10, cfg.CacheTTL))(backend)
+
+	first := cachedGet(handler, "/api/rag/lookup", "user-1")
+	other := cachedGet(handler, "/api/rag/lookup", "user-2")
+	if got := other.Header().Get("X-Cache"); got != "MISS" {
+		t.Fatalf("different user X-Cache = %q, want MISS", got)
+	}
+	if other.Body.String() == first.Body.String() {
+		t.Error("user-2 was served user-1's cached response")
+	}
+}
+
+func TestCacheSkipsNoStore(t *testing.T) {
+	cfg := &config.Config{CacheTTL: time.Minute}
+	handler := CacheMiddleware(cfg, NewResponseCache(10, cfg.CacheTTL))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write([]byte("sensitive"))
+		}))
+
+	cachedGet(handler, "/api/rag/lookup", "user-1")
+	rec := cachedGet(handler, "/api/rag/lookup", "user-1")
+	if got := rec.Header().Get("X-Cache"); got != "MISS" {
+		t.Fatalf("no-store response X-Cache = %q, want MISS", got)
+	}
+}
+
+func TestCacheSkipsEventStreams(t *testing.T) {
+	cfg := &config.Config{CacheTTL: time.Minute}
+	calls := 0
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: event\n\n"))
+	})
+	handler := CacheMiddleware(cfg, NewResponseCache(10, cfg.CacheTTL))(backend)
+
+	cachedGet(handler, "/api/llm/stream", "user-1")
+	rec := cachedGet(handler, "/api/llm/stream", "user-1")
+	if got := rec.Header().Get("X-Cache"); got != "MISS" {
+		t.Fatalf("event stream X-Cache = %q, want MISS (streams are never cached)", got)
+	}
+	if calls != 2 {
+		t.Errorf("backend called %d times, want 2", calls)
+	}
+}
+
+func TestCacheSkipsFlushedResponses(t *testing.T) {
+	cfg := &config.Config{CacheTTL: time.Minute}
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("chunk-1"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("chunk-2"))
+	})
+	handler := CacheMiddleware(cfg, NewResponseCache(10, cfg.CacheTTL))(backend)
+
+	cachedGet(handler, "/api/llm/generate", "user-1")
+	rec := cachedGet(handler, "/api/llm/generate", "user-1")
+	if got := rec.Header().Get("X-Cache"); got != "MISS" {
+		t.Fatalf("flushed response X-Cache = %q, want MISS", got)
+	}
+}
+
+func TestCacheCapsEntrySize(t *testing.T) {
+	cfg := &config.Config{CacheTTL: time.Minute}
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, maxRecordedBodyBytes+1))
+	})
+	handler := CacheMiddleware(cfg, NewResponseCache(10, cfg.CacheTTL))(backend)
+
+	cachedGet(handler, "/api/rag/dump", "user-1")
+	rec := cachedGet(handler, "/api/rag/dump", "user-1")
+	if got := rec.Header().Get("X-Cache"); got != "MISS" {
+		t.Fatalf("oversized response X-Cache = %q, want MISS (body exceeds the cap)", got)
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// RemoteIP returns just the IP portion of r.RemoteAddr, tolerating the
+// forms that show up in embedded and test scenarios: host:port, a bare IP
+// (v4 or v6), a bracketed IPv6 address without a port, and empty. An empty
+// or unusable address resolves to "unknown" so downstream identities (the
+// anonymous user ID, rate-limit keys) never collapse to an empty string.
+func RemoteIP(r *http.Request) string {
+	addr := r.RemoteAddr
+	if addr == "" {
+		return "unknown"
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	// No port: strip IPv6 brackets if present and take the rest verbatim —
+	// a bare IPv6 address trips SplitHostPort's "too many colons" check.
+	if strings.HasPrefix(addr, "[") && strings.HasSuffix(addr, "]") {
+		return addr[1 : len(addr)-1]
+	}
+	return addr
+}
+
+// FromTrustedProxy reports whether the request's peer address falls inside
+// one of the configured TRUSTED_PROXIES CIDRs.
+func FromTrustedProxy(r *http.Request, cfg *config.Config) bool {
+	ip := net.ParseIP(RemoteIP(r))
+	if ip == nil {
+		return false
+	}
+	for _, n := range cfg.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP resolves the real client IP: the leftmost X-Forwarded-For entry
+// (falling back to X-Real-IP) when the connection comes from a trusted
+// proxy, otherwise the peer address itself — forwarded headers from
+// untrusted sources are spoofable and ignored.
+func ClientIP(r *http.Request, cfg *config.Config) string {
+	if FromTrustedProxy(r, cfg) {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			first := strings.TrimSpace(strings.Split(xff, ",")[0])
+			if net.ParseIP(first) != nil {
+				return first
+			}
+		}
+		if rip := r.Header.Get("X-Real-IP"); rip != "" && net.ParseIP(rip) != nil {
+			return rip
+		}
+	}
+	return RemoteIP(r)
+}
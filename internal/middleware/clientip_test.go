@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+func TestRemoteIPToleratesAddressForms(t *testing.T) {
+	cases := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"1.2.3.4:5678", "1.2.3.4"},
+		{"1.2.3.4", "1.2.3.4"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"", "unknown"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/agent/x", nil)
+		req.RemoteAddr = tc.remoteAddr
+		if got := RemoteIP(req); got != tc.want {
+			t.Errorf("RemoteIP(%q) = %q, want %q", tc.remoteAddr, got, tc.want)
+		}
+	}
+}
+
+func TestAnonymousIDNeverEmpty(t *testing.T) {
+	cfg := &config.Config{}
+	for _, remoteAddr := range []string{"", "2001:db8::1", "1.2.3.4"} {
+		var userID string
+		handler := AuthMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID = GetUserID(r)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/api/agent/x", nil)
+		req.RemoteAddr = remoteAddr
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if userID == "anonymous-" || !strings.HasPrefix(userID, "anonymous-") {
+			t.Errorf("RemoteAddr %q: anonymous ID = %q, want non-empty suffix", remoteAddr, userID)
+		}
+	}
+}
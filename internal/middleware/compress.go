@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// compressWriter buffers a response until it knows whether compression is
+// worthwhile: small responses and exempt content pass through untouched,
+// larger ones are gzipped. Header writes are deferred until that decision
+// because Content-Length must be dropped when compressing.
+type compressWriter struct {
+	http.ResponseWriter
+	minSize int
+
+	status  int
+	decided bool
+	gz      *gzip.Writer
+	buf     []byte
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	// Informational 1xx responses go out immediately — the final status
+	// follows them, so they must not be latched as the compression
+	// decision's status. 101 stays final: the connection upgrades.
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		if w.exempt() {
+			w.commit(false)
+		} else {
+			w.buf = append(w.buf, b...)
+			if len(w.buf) < w.minSize {
+				return len(b), nil
+			}
+			w.commit(true)
+			return len(b), nil
+		}
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// exempt reports whether the response must not be compressed: upstream
+// already encoded it, or it is a live event stream.
+func (w *compressWriter) exempt() bool {
+	if w.Header().Get("Content-Encoding") != "" {
+		return true
+	}
+	ct := w.Header().Get("Content-Type")
+	return strings.HasPrefix(ct, "text/event-stream")
+}
+
+// commit makes the compression decision, writes the response headers, and
+// drains the buffer.
+func (w *compressWriter) commit(compress bool) {
+	w.decided = true
+	if compress {
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) > 0 {
+		if w.gz != nil {
+			w.gz.Write(w.buf)
+		} else {
+			w.ResponseWriter.Write(w.buf)
+		}
+		w.buf = nil
+	}
+}
+
+// finish flushes whatever is pending once the handler returns; an undecided
+// response stayed under the threshold and goes out uncompressed.
+func (w *compressWriter) finish() {
+	if !w.decided {
+		w.commit(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// Flush forces the pending decision so streaming handlers aren't held in
+// the buffer, then flushes downstream.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.commit(false)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack forwards to the underlying writer when it supports hijacking; a
+// taken-over connection (an Upgrade from a gzip-accepting client) is decided
+// as uncompressed, draining anything buffered first so no bytes are lost.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	if !w.decided {
+		if len(w.buf) > 0 {
+			w.commit(false)
+		} else {
+			w.decided = true
+		}
+	}
+	return h.Hijack()
+}
+
+// Unwrap exposes the wrapped writer so http.ResponseController can reach
+// the connection's deadline controls.
+func (w *compressWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// CompressionMiddleware gzips responses larger than COMPRESSION_MIN_BYTES
+// for clients that accept it, leaving pre-compressed upstream responses and
+// SSE streams alone.
+func CompressionMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, minSize: cfg.CompressionMinBytes}
+			defer cw.finish()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
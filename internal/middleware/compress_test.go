@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+func TestCompressionGzipsLargeJSON(t *testing.T) {
+	body := `{"data":"` + strings.Repeat("a", 2048) + `"}`
+	cfg := &config.Config{CompressionMinBytes: 1024}
+	handler := CompressionMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", got)
+	}
+	gr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("response is not valid gzip: %v", err)
+	}
+	decoded, _ := io.ReadAll(gr)
+	if !bytes.Equal(decoded, []byte(body)) {
+		t.Error("decompressed body does not match the original")
+	}
+}
+
+func TestCompressionSkipsPreCompressed(t *testing.T) {
+	payload := strings.Repeat("b", 2048)
+	cfg := &config.Config{CompressionMinBytes: 1024}
+	handler := CompressionMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		w.Write([]byte(payload))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "br" {
+		t.Fatalf("Content-Encoding = %q, want br untouched", got)
+	}
+	if rec.Body.String() != payload {
+		t.Error("pre-compressed body was modified")
+	}
+}
+
+func TestCompressionLeavesSmallResponsesAlone(t *testing.T) {
+	cfg := &config.Config{CompressionMinBytes: 1024}
+	handler := CompressionMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Fatalf("Content-Encoding = %q, want none for a tiny body", got)
+	}
+	if rec.Body.String() != `{"ok":true}` {
+		t.Error("small body was modified")
+	}
+}
+
+func TestCompressionAllowsHijack(t *testing.T) {
+	cfg := &config.Config{CompressionMinBytes: 1024}
+	underlying := &hijackWriter{ResponseRecorder: httptest.NewRecorder()}
+	handler := CompressionMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+			t.Errorf("Hijack through compression chain: %v", err)
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/ws", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(underlying, req)
+
+	if !underlying.hijacked {
+		t.Fatal("hijack did not reach the underlying writer")
+	}
+	if underlying.Code != http.StatusOK || underlying.Body.Len() != 0 {
+		t.Fatalf("wrapper wrote to a hijacked connection: code=%d body=%q",
+			underlying.Code, underlying.Body.String())
+	}
+}
+
+// statusRecorder records every WriteHeader call, informational ones
+// included, where httptest.ResponseRecorder latches only the first.
+type statusRecorder struct {
+	*httptest.ResponseRecorder
+	statuses []int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.statuses = append(s.statuses, code)
+	if code >= http.StatusOK {
+		s.ResponseRecorder.WriteHeader(code)
+	}
+}
+
+func TestCompressionForwardsEarlyHints(t *testing.T) {
+	cfg := &config.Config{CompressionMinBytes: 8}
+	underlying := &statusRecorder{ResponseRecorder: httptest.NewRecorder()}
+	handler := CompressionMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"body":"large enough to cross the threshold"}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/page", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(underlying, req)
+
+	if len(underlying.statuses) == 0 || underlying.statuses[0] != http.StatusEarlyHints {
+		t.Fatalf("statuses = %v, want the 103 forwarded ahead of the final status", underlying.statuses)
+	}
+	if final := underlying.statuses[len(underlying.statuses)-1]; final != http.StatusOK {
+		t.Fatalf("final status = %d, want 200", final)
+	}
+}
+
+func TestCompressionDrainsBufferBeforeHijack(t *testing.T) {
+	cfg := &config.Config{CompressionMinBytes: 1024}
+	underlying := &hijackWriter{ResponseRecorder: httptest.NewRecorder()}
+	handler := CompressionMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Below the threshold, so this sits in the decision buffer when
+		// the takeover happens.
+		w.Write([]byte("confirmed"))
+		if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+			t.Errorf("Hijack through compression chain: %v", err)
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/takeover", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(underlying, req)
+
+	if !underlying.hijacked {
+		t.Fatal("hijack did not reach the underlying writer")
+	}
+	if underlying.Body.String() != "confirmed" {
+		t.Fatalf("buffered bytes lost across the hijack: body = %q", underlying.Body.String())
+	}
+}
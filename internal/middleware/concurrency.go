@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// ConcurrencyLimiter tracks in-flight request counts per client so a single
+// API-key tenant can't monopolize the gateway.
+type ConcurrencyLimiter struct {
+	mu       sync.Mutex
+	caps     map[string]int
+	inFlight map[string]int
+}
+
+// NewConcurrencyLimiter returns a limiter enforcing the given per-client
+// caps; clients without an entry are unlimited.
+func NewConcurrencyLimiter(caps map[string]int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		caps:     caps,
+		inFlight: make(map[string]int),
+	}
+}
+
+// Acquire reserves an in-flight slot for the client, reporting false when
+// the client is at its cap. Callers must Release on true.
+func (cl *ConcurrencyLimiter) Acquire(id string) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cap, ok := cl.caps[id]
+	if !ok {
+		return true
+	}
+	if cl.inFlight[id] >= cap {
+		return false
+	}
+	cl.inFlight[id]++
+	return true
+}
+
+// Release returns the client's in-flight slot.
+func (cl *ConcurrencyLimiter) Release(id string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if _, ok := cl.caps[id]; !ok {
+		return
+	}
+	if cl.inFlight[id] > 0 {
+		cl.inFlight[id]--
+	}
+	if cl.inFlight[id] == 0 {
+		delete(cl.inFlight, id)
+	}
+}
+
+// ConcurrencyLimitMiddleware enforces per-client concurrency caps (from
+// API_KEY_CONCURRENCY) after auth has resolved the client ID, returning 429
+// when a capped client already has its maximum requests in flight.
+func ConcurrencyLimitMiddleware(cfg *config.Config, cl *ConcurrencyLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Public routes are never limited.
+			if isPublicPath(r, cfg) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id := GetUserID(r)
+			if id == "" {
+				id = ClientIP(r, cfg)
+			}
+
+			if !cl.Acquire(id) {
+				w.Header().Set("Retry-After", strconv.Itoa(concurrencyRetryAfterSeconds(cfg)))
+				writeAuthError(w, http.StatusTooManyRequests, "concurrency limit exceeded")
+				return
+			}
+			defer cl.Release(id)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// concurrencyRetryAfterSeconds converts the configured back-off hint to
+// whole seconds, with a one-second floor so clients always get a usable
+// value.
+func concurrencyRetryAfterSeconds(cfg *config.Config) int {
+	secs := int(cfg.ConcurrencyRetryAfter.Seconds())
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// contextWithUserID mirrors what AuthMiddleware stores for downstream
+// middleware.
+func contextWithUserID(r *http.Request, id string) context.Context {
+	return context.WithValue(r.Context(), userIDKey, id)
+}
+
+func concurrencyRequest(tenant string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/run", nil)
+	return req.WithContext(contextWithUserID(req, tenant))
+}
+
+func TestConcurrencyCapIsolatesClients(t *testing.T) {
+	cfg := &config.Config{APIKeyConcurrency: map[string]int{"tenantA": 2}}
+	cl := NewConcurrencyLimiter(cfg.APIKeyConcurrency)
+	mw := ConcurrencyLimitMiddleware(cfg, cl)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	blocking := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	instant := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Saturate tenantA's two slots with held requests.
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blocking.ServeHTTP(httptest.NewRecorder(), concurrencyRequest("tenantA"))
+		}()
+	}
+	<-started
+	<-started
+
+	// A third tenantA request is rejected while the slots are held.
+	rec := httptest.NewRecorder()
+	instant.ServeHTTP(rec, concurrencyRequest("tenantA"))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("saturated tenant: got status %d, want 429", rec.Code)
+	}
+
+	// An uncapped tenant proceeds regardless.
+	rec = httptest.NewRecorder()
+	instant.ServeHTTP(rec, concurrencyRequest("tenantB"))
+	if rec.Code != http.StatusOK {
+		t.Errorf("other tenant: got status %d, want 200", rec.Code)
+	}
+
+	close(release)
+	wg.Wait()
+
+	// With the slots released, tenantA is admitted again.
+	rec = httptest.NewRecorder()
+	instant.ServeHTTP(rec, concurrencyRequest("tenantA"))
+	if rec.Code != http.StatusOK {
+		t.Errorf("after release: got status %d, want 200", rec.Code)
+	}
+}
+
+func TestConcurrencyRejectionCarriesRetryAfter(t *testing.T) {
+	cfg := &config.Config{
+		APIKeyConcurrency:     map[string]int{"tenantA": 1},
+		ConcurrencyRetryAfter: 5 * time.Second,
+	}
+	cl := NewConcurrencyLimiter(cfg.APIKeyConcurrency)
+	mw := ConcurrencyLimitMiddleware(cfg, cl)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	blocking := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	go blocking.ServeHTTP(httptest.NewRecorder(), concurrencyRequest("tenantA"))
+	<-started
+	defer close(release)
+
+	rec := httptest.NewRecorder()
+	mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, concurrencyRequest("tenantA"))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("Retry-After = %q, want 5", got)
+	}
+}
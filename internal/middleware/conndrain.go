@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/drain"
+)
+
+// ConnDrainMiddleware registers connections that handlers hijack — WebSocket
+// upgrades and other takeovers — with the drain registry, so shutdown can
+// close them after the grace period instead of abandoning them. Ordinary
+// responses are untouched; srv.Shutdown already waits for those.
+func ConnDrainMiddleware(reg *drain.Registry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := GetRequestID(r)
+			if id == "" {
+				id = r.RemoteAddr
+			}
+			next.ServeHTTP(&drainWriter{ResponseWriter: w, reg: reg, id: id}, r)
+		})
+	}
+}
+
+// drainWriter intercepts Hijack to track the taken-over connection.
+type drainWriter struct {
+	http.ResponseWriter
+	reg *drain.Registry
+	id  string
+}
+
+func (d *drainWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := d.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	tracked := &trackedConn{Conn: conn, reg: d.reg, id: d.id}
+	d.reg.Register(d.id, tracked)
+	return tracked, rw, nil
+}
+
+func (d *drainWriter) Flush() {
+	if f, ok := d.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (d *drainWriter) Unwrap() http.ResponseWriter { return d.ResponseWriter }
+
+// trackedConn deregisters itself when the handler closes the connection on
+// its own, so only still-open connections remain for shutdown to force.
+type trackedConn struct {
+	net.Conn
+	reg *drain.Registry
+	id  string
+}
+
+func (c *trackedConn) Close() error {
+	c.reg.Deregister(c.id)
+	return c.Conn.Close()
+}
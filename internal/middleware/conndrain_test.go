@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/drain"
+)
+
+func TestConnDrainClosesHijackedStreamOnShutdown(t *testing.T) {
+	reg := drain.NewRegistry()
+	handler := ConnDrainMiddleware(reg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack failed: %v", err)
+			return
+		}
+		// A minimal never-ending stream: headers out, then hold the
+		// connection open until someone closes it.
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/event-stream\r\n\r\n")
+		rw.Flush()
+		_ = conn
+	}))
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream")
+	if err != nil {
+		t.Fatalf("opening stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	for i := 0; i < 100 && reg.Active() == 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := reg.Active(); got != 1 {
+		t.Fatalf("Active = %d with a hijacked stream open, want 1", got)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		reg.Shutdown(100 * time.Millisecond)
+		close(done)
+	}()
+
+	// The read unblocks with EOF (or a reset) once shutdown closes the
+	// connection; without draining it would hang past the deadline.
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := bufio.NewReader(resp.Body).ReadByte()
+		readErr <- err
+	}()
+	select {
+	case err := <-readErr:
+		if err == nil {
+			t.Fatal("read returned data, want the stream closed")
+		}
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			// A TCP reset is also an acceptable way for the stream to end.
+			t.Logf("stream ended with %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream not closed within the grace window")
+	}
+	<-done
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// CORSMiddleware answers preflight requests and sets CORS headers on
+// gateway-originated responses. Proxied responses get their CORS headers via
+// the proxy's ModifyResponse so upstream headers can be stripped first.
+func CORSMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin != "" && OriginAllowed(origin, cfg.CORSOrigins) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				w.Header().Set("Vary", "Origin")
+			}
+
+			if r.Method == http.MethodOptions {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Request-ID, X-User-ID")
+				w.Header().Set("Access-Control-Max-Age", "86400")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// OriginAllowed reports whether origin is permitted by the configured list.
+// An empty list allows any origin (development only).
+// OriginAllowedStrict is the environment-aware variant: an empty allow-list
+// means allow-all only outside production, so a misconfigured prod deploy
+// doesn't silently reflect arbitrary origins.
+func OriginAllowedStrict(origin string, cfg *config.Config) bool {
+	if len(cfg.CORSOrigins) == 0 {
+		return !cfg.IsProduction()
+	}
+	return OriginAllowed(origin, cfg.CORSOrigins)
+}
+
+func OriginAllowed(origin string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if a == origin || a == "*" {
+			return true
+		}
+	}
+	return false
+}
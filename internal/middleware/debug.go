@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// CapturedRequest is one sampled request's metadata, enough to diagnose
+// intermittent issues without global body logging.
+type CapturedRequest struct {
+	Timestamp  string            `json:"timestamp"`
+	RequestID  string            `json:"request_id"`
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Status     int               `json:"status"`
+	DurationMS int64             `json:"duration_ms"`
+	UserID     string            `json:"user_id,omitempty"`
+	RemoteAddr string            `json:"remote_addr"`
+	Headers    map[string]string `json:"headers"`
+}
+
+// DebugCapture samples requests into a bounded ring buffer, newest
+// overwriting oldest.
+type DebugCapture struct {
+	mu      sync.Mutex
+	entries []CapturedRequest
+	next    int
+	full    bool
+	rate    float64
+}
+
+// NewDebugCapture returns a capture sampling the given fraction of requests
+// into a ring of size entries. The ring is floored at one entry so a zero
+// or negative DEBUG_BUFFER_SIZE cannot leave add dividing by zero.
+func NewDebugCapture(rate float64, size int) *DebugCapture {
+	if size < 1 {
+		size = 1
+	}
+	return &DebugCapture{
+		entries: make([]CapturedRequest, size),
+		rate:    rate,
+	}
+}
+
+func (c *DebugCapture) add(entry CapturedRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[c.next] = entry
+	c.next = (c.next + 1) % len(c.entries)
+	if c.next == 0 {
+		c.full = true
+	}
+}
+
+// Snapshot returns the captured requests, oldest first.
+func (c *DebugCapture) Snapshot() []CapturedRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.full {
+		return append([]CapturedRequest(nil), c.entries[:c.next]...)
+	}
+	out := make([]CapturedRequest, 0, len(c.entries))
+	out = append(out, c.entries[c.next:]...)
+	out = append(out, c.entries[:c.next]...)
+	return out
+}
+
+// Handler serves the capture buffer as JSON; mount it under the
+// admin-guarded /gateway/ routes.
+func (c *DebugCapture) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Snapshot())
+	}
+}
+
+// DebugCaptureMiddleware records a sampled subset of /api/ requests into the
+// capture buffer.
+func DebugCaptureMiddleware(cfg *config.Config, c *DebugCapture) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rand.Float64() >= c.rate {
+				next.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			rw := NewResponseRecorder(w)
+			next.ServeHTTP(rw, r)
+
+			headers := make(map[string]string, len(r.Header))
+			for name := range r.Header {
+				if name == "Authorization" || name == "X-Api-Key" {
+					headers[name] = "[redacted]"
+					continue
+				}
+				headers[name] = r.Header.Get(name)
+			}
+			c.add(CapturedRequest{
+				Timestamp:  start.UTC().Format(time.RFC3339Nano),
+				RequestID:  GetRequestID(r),
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Status:     rw.Status(),
+				DurationMS: time.Since(start).Milliseconds(),
+				UserID:     GetUserID(r),
+				RemoteAddr: r.RemoteAddr,
+				Headers:    headers,
+			})
+		})
+	}
+}
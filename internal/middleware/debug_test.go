@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+func TestDebugCaptureRecordsAndBounds(t *testing.T) {
+	cfg := &config.Config{DebugSampleRate: 1.0, DebugBufferSize: 3}
+	capture := NewDebugCapture(cfg.DebugSampleRate, cfg.DebugBufferSize)
+	handler := DebugCaptureMiddleware(cfg, capture)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/agent/run/"+strconv.Itoa(i), nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rec := httptest.NewRecorder()
+	capture.Handler()(rec, httptest.NewRequest(http.MethodGet, "/gateway/debug/requests", nil))
+
+	var captured []CapturedRequest
+	if err := json.NewDecoder(rec.Body).Decode(&captured); err != nil {
+		t.Fatalf("endpoint did not return JSON: %v", err)
+	}
+	if len(captured) != 3 {
+		t.Fatalf("buffer holds %d entries, want it bounded at 3", len(captured))
+	}
+	// The ring keeps the newest entries, oldest first.
+	if captured[0].Path != "/api/agent/run/2" || captured[2].Path != "/api/agent/run/4" {
+		t.Errorf("unexpected window %q .. %q", captured[0].Path, captured[2].Path)
+	}
+	if captured[0].Status != http.StatusTeapot {
+		t.Errorf("status = %d, want 418", captured[0].Status)
+	}
+}
+
+func TestDebugCaptureZeroRateCapturesNothing(t *testing.T) {
+	cfg := &config.Config{DebugBufferSize: 3}
+	capture := NewDebugCapture(0, cfg.DebugBufferSize)
+	handler := DebugCaptureMiddleware(cfg, capture)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 10; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/agent/run", nil))
+	}
+	if got := len(capture.Snapshot()); got != 0 {
+		t.Fatalf("captured %d requests at rate 0, want 0", got)
+	}
+}
+
+func TestDebugCaptureZeroSizeFloorsToOne(t *testing.T) {
+	capture := NewDebugCapture(1.0, 0)
+	// A zero-size ring used to panic with a division by zero on the first
+	// sampled request.
+	capture.add(CapturedRequest{Path: "/api/agent/run"})
+	if got := len(capture.Snapshot()); got != 1 {
+		t.Fatalf("snapshot has %d entries, want 1", got)
+	}
+}
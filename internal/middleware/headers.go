@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// headerWriter injects the configured default headers just before the first
+// write, so proxied upstream values are visible and win unless override is
+// set.
+type headerWriter struct {
+	http.ResponseWriter
+	headers  map[string]string
+	override bool
+	wrote    bool
+}
+
+func (w *headerWriter) apply() {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	for name, value := range w.headers {
+		if w.override || w.Header().Get(name) == "" {
+			w.Header().Set(name, value)
+		}
+	}
+}
+
+func (w *headerWriter) WriteHeader(status int) {
+	w.apply()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	w.apply()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush applies the headers (a flush commits them) and forwards to the
+// underlying writer when it supports flushing.
+func (w *headerWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.apply()
+		f.Flush()
+	}
+}
+
+// Hijack forwards to the underlying writer when it supports hijacking.
+func (w *headerWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap exposes the wrapped writer so http.ResponseController can reach
+// the connection's deadline controls.
+func (w *headerWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// SecurityHeadersMiddleware sets the configured default response headers
+// (hardening headers like X-Content-Type-Options by default) on every
+// response, gateway-generated and proxied alike. Upstream-set values are
+// preserved unless SECURITY_HEADERS_OVERRIDE is on.
+func SecurityHeadersMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hw := &headerWriter{
+				ResponseWriter: w,
+				headers:        cfg.SecurityHeaders,
+				override:       cfg.SecurityHeadersOverride,
+			}
+			next.ServeHTTP(hw, r)
+			// Responses with no body still get the headers.
+			hw.apply()
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/liveness"
+)
+
+// idempotencyEntry holds one key's response; done is closed once the first
+// request completes so concurrent holders of the same key can wait.
+type idempotencyEntry struct {
+	done    chan struct{}
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// IdempotencyStore tracks in-flight and completed responses per
+// Idempotency-Key, scoped per user, with TTL eviction.
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	ttl     time.Duration
+}
+
+// NewIdempotencyStore returns a store replaying responses for ttl and
+// starts a background sweeper for expired entries.
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	s := &IdempotencyStore{
+		entries: make(map[string]*idempotencyEntry),
+		ttl:     ttl,
+	}
+	go s.sweep()
+	return s
+}
+
+// sweep periodically drops expired entries — keys are client-chosen, so
+// without it the map grows with every distinct key ever seen. It beats the
+// liveness registry each pass so /health notices if this loop dies.
+func (s *IdempotencyStore) sweep() {
+	liveness.Register("idempotency-sweeper")
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		liveness.Beat("idempotency-sweeper")
+		s.evictExpired(time.Now())
+	}
+}
+
+// evictExpired removes completed entries past their expiry; in-flight
+// entries stay — their owners will complete them.
+func (s *IdempotencyStore) evictExpired(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, entry := range s.entries {
+		select {
+		case <-entry.done:
+			if now.After(entry.expires) {
+				delete(s.entries, key)
+			}
+		default:
+		}
+	}
+}
+
+// claim returns the entry for key and whether the caller owns it (i.e. is
+// the first request and must execute and complete it). Expired entries are
+// replaced.
+func (s *IdempotencyStore) claim(key string) (*idempotencyEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[key]; ok {
+		select {
+		case <-entry.done:
+			if time.Now().Before(entry.expires) {
+				return entry, false
+			}
+			// Expired: fall through and start fresh.
+		default:
+			// Still in flight; the caller waits on it.
+			return entry, false
+		}
+	}
+	entry := &idempotencyEntry{done: make(chan struct{})}
+	s.entries[key] = entry
+	return entry, true
+}
+
+// complete records the response and releases any waiters.
+func (s *IdempotencyStore) complete(entry *idempotencyEntry, status int, header http.Header, body []byte) {
+	entry.status = status
+	entry.header = header
+	entry.body = body
+	entry.expires = time.Now().Add(s.ttl)
+	close(entry.done)
+}
+
+// IdempotencyMiddleware replays the first response for a given
+// Idempotency-Key (per user) within the TTL, marking replays with
+// X-Idempotent-Replay: true. Concurrent requests sharing a key wait for the
+// first instead of hitting the backend twice.
+func IdempotencyMiddleware(cfg *config.Config, store *IdempotencyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idemKey := r.Header.Get("Idempotency-Key")
+			if idemKey == "" || r.Method == http.MethodGet || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user := GetUserID(r)
+			if user == "" {
+				user = ClientIP(r, cfg)
+			}
+			entry, owned := store.claim(user + "|" + r.URL.Path + "|" + idemKey)
+
+			if !owned {
+				select {
+				case <-entry.done:
+				case <-r.Context().Done():
+					return
+				}
+				for name, values := range entry.header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("X-Idempotent-Replay", "true")
+				w.WriteHeader(entry.status)
+				w.Write(entry.body)
+				return
+			}
+
+			rec := &cacheRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			header := make(http.Header, len(rec.Header()))
+			for name, values := range rec.Header() {
+				header[name] = append([]string(nil), values...)
+			}
+			store.complete(entry, rec.status, header, append([]byte(nil), rec.buf.Bytes()...))
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+func idempotentPost(handler http.Handler, key, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/llm/generate", strings.NewReader(`{}`))
+	req.Header.Set("Idempotency-Key", key)
+	req = req.WithContext(contextWithUserID(req, user))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyReplaysFirstResponse(t *testing.T) {
+	var calls atomic.Int64
+	cfg := &config.Config{IdempotencyTTL: time.Minute}
+	handler := IdempotencyMiddleware(cfg, NewIdempotencyStore(cfg.IdempotencyTTL))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("generation-" + strconv.FormatInt(calls.Add(1), 10)))
+		}))
+
+	first := idempotentPost(handler, "key-1", "user-1")
+	second := idempotentPost(handler, "key-1", "user-1")
+
+	if calls.Load() != 1 {
+		t.Fatalf("backend called %d times, want 1", calls.Load())
+	}
+	if second.Body.String() != first.Body.String() {
+		t.Errorf("replay body = %q, want %q", second.Body.String(), first.Body.String())
+	}
+	if got := second.Header().Get("X-Idempotent-Replay"); got != "true" {
+		t.Errorf("X-Idempotent-Replay = %q, want true", got)
+	}
+	if first.Header().Get("X-Idempotent-Replay") != "" {
+		t.Error("first response must not be marked as a replay")
+	}
+
+	// A different key or user hits the backend fresh.
+	idempotentPost(handler, "key-2", "user-1")
+	idempotentPost(handler, "key-1", "user-2")
+	if calls.Load() != 3 {
+		t.Errorf("backend called %d times, want 3", calls.Load())
+	}
+}
+
+func TestIdempotencyDedupesConcurrentRequests(t *testing.T) {
+	var calls atomic.Int64
+	release := make(chan struct{})
+	cfg := &config.Config{IdempotencyTTL: time.Minute}
+	handler := IdempotencyMiddleware(cfg, NewIdempotencyStore(cfg.IdempotencyTTL))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			<-release
+			w.Write([]byte("done"))
+		}))
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i] = idempotentPost(handler, "key-1", "user-1").Body.String()
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("backend called %d times for concurrent duplicates, want 1", calls.Load())
+	}
+	if bodies[0] != "done" || bodies[1] != "done" {
+		t.Errorf("bodies = %q, want both \"done\"", bodies)
+	}
+}
+
+func TestIdempotencyKeyExpires(t *testing.T) {
+	var calls atomic.Int64
+	cfg := &config.Config{IdempotencyTTL: 30 * time.Millisecond}
+	handler := IdempotencyMiddleware(cfg, NewIdempotencyStore(cfg.IdempotencyTTL))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+		}))
+
+	idempotentPost(handler, "key-1", "user-1")
+	time.Sleep(50 * time.Millisecond)
+	rec := idempotentPost(handler, "key-1", "user-1")
+
+	if calls.Load() != 2 {
+		t.Fatalf("backend called %d times, want 2 after expiry", calls.Load())
+	}
+	if rec.Header().Get("X-Idempotent-Replay") != "" {
+		t.Error("post-expiry response must not be a replay")
+	}
+}
+
+func TestIdempotencyEvictsExpiredEntries(t *testing.T) {
+	store := NewIdempotencyStore(time.Minute)
+
+	done, owned := store.claim("user|/api/llm/generate|done-key")
+	if !owned {
+		t.Fatal("first claim should be owned")
+	}
+	store.complete(done, http.StatusOK, http.Header{}, []byte("ok"))
+	if _, owned := store.claim("user|/api/llm/generate|inflight-key"); !owned {
+		t.Fatal("second claim should be owned")
+	}
+
+	// Past the TTL the completed entry goes; the in-flight one stays for
+	// its owner to complete.
+	store.evictExpired(time.Now().Add(2 * time.Minute))
+
+	store.mu.Lock()
+	remaining := len(store.entries)
+	store.mu.Unlock()
+	if remaining != 1 {
+		t.Fatalf("entries = %d after eviction, want only the in-flight one", remaining)
+	}
+}
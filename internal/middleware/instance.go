@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// InstanceHeaderMiddleware stamps every response with X-Gateway-Instance so
+// a multi-replica deployment can tell which pod served a request. The value
+// is INSTANCE_ID, falling back to the hostname; it is resolved once at
+// wiring time. Applied outermost, so health, proxy, and error responses all
+// carry it.
+func InstanceHeaderMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	instance := cfg.InstanceID
+	if instance == "" {
+		if hostname, err := os.Hostname(); err == nil {
+			instance = hostname
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if instance != "" {
+				w.Header().Set("X-Gateway-Instance", instance)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+func TestInstanceHeaderReflectsConfiguredID(t *testing.T) {
+	cfg := &config.Config{InstanceID: "gateway-7f9c"}
+	handler := InstanceHeaderMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if got := rec.Header().Get("X-Gateway-Instance"); got != "gateway-7f9c" {
+		t.Fatalf("X-Gateway-Instance = %q, want gateway-7f9c", got)
+	}
+	// The header rides along even on error statuses.
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("status = %d, want the handler's own", rec.Code)
+	}
+}
+
+func TestInstanceHeaderFallsBackToHostname(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("hostname unavailable: %v", err)
+	}
+	handler := InstanceHeaderMiddleware(&config.Config{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("X-Gateway-Instance"); got != hostname {
+		t.Fatalf("X-Gateway-Instance = %q, want hostname %q", got, hostname)
+	}
+}
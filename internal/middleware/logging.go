@@ -0,0 +1,259 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// LogEntry documents the fields of the JSON access-log record. The log
+// object is built dynamically so LOG_FIELDS can allow-list a subset.
+type LogEntry struct {
+	Timestamp  string `json:"timestamp"`
+	RequestID  string `json:"request_id"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Status     int    `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+	UserID     string `json:"user_id,omitempty"`
+	RemoteAddr string `json:"remote_addr"`
+
+	// RequestBytes is the inbound Content-Length; ResponseBytes counts
+	// what was actually written to the client.
+	RequestBytes  int64 `json:"request_bytes"`
+	ResponseBytes int64 `json:"response_bytes"`
+
+	// ContentType is the response Content-Type, for cost attribution of
+	// payload classes (event streams vs JSON).
+	ContentType string `json:"content_type,omitempty"`
+
+	// Route is the matched route prefix (e.g. /api/agent), a low-cardinality
+	// grouping key next to the concrete Path.
+	Route string `json:"route"`
+}
+
+// requestIDKey is the context key under which the request ID is stored.
+const requestIDKey contextKey = "requestID"
+
+// GetRequestID returns the request ID assigned by LoggingMiddleware, or ""
+// when the middleware did not run. Mirrors GetUserID.
+func GetRequestID(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// WithRequestID returns a context carrying the given request ID, for code
+// (and tests) running outside LoggingMiddleware.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// durationWriter stamps X-Gateway-Duration-Ms just before the first byte of
+// the response goes out, so the header reflects actual processing time.
+type durationWriter struct {
+	http.ResponseWriter
+	start   time.Time
+	stamped bool
+}
+
+func (dw *durationWriter) stamp() {
+	if dw.stamped {
+		return
+	}
+	dw.stamped = true
+	dw.Header().Set("X-Gateway-Duration-Ms", strconv.FormatInt(time.Since(dw.start).Milliseconds(), 10))
+}
+
+func (dw *durationWriter) WriteHeader(status int) {
+	dw.stamp()
+	dw.ResponseWriter.WriteHeader(status)
+}
+
+func (dw *durationWriter) Write(b []byte) (int, error) {
+	dw.stamp()
+	return dw.ResponseWriter.Write(b)
+}
+
+// Flush stamps the header and forwards the flush, so SSE responses behind
+// the duration header keep streaming.
+func (dw *durationWriter) Flush() {
+	dw.stamp()
+	if f, ok := dw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack forwards to the underlying writer when it supports hijacking.
+func (dw *durationWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := dw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap exposes the wrapped writer for http.ResponseController.
+func (dw *durationWriter) Unwrap() http.ResponseWriter { return dw.ResponseWriter }
+
+// LoggingMiddleware assigns each request an X-Request-ID (honoring an
+// inbound one, unless REQUEST_ID_TRUSTED_ONLY restricts that to trusted
+// proxies) and emits a JSON access-log entry when the request completes.
+// cfg.LogFields, when set, restricts which fields appear in the output.
+// Entries go to the standard logger; see LoggingMiddlewareTo for a
+// dedicated access-log destination.
+func LoggingMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	return LoggingMiddlewareTo(cfg, nil)
+}
+
+// LoggingMiddlewareTo is LoggingMiddleware writing its entries to out (one
+// JSON object per line) instead of the standard logger — typically a
+// RotatingWriter when ACCESS_LOG_FILE is set. A nil out falls back to the
+// standard logger.
+func LoggingMiddlewareTo(cfg *config.Config, out io.Writer) func(http.Handler) http.Handler {
+	allowed := logFieldSet(cfg.LogFields)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestID := r.Header.Get("X-Request-ID")
+			if cfg.RequestIDTrustedOnly && !FromTrustedProxy(r, cfg) {
+				// IDs injected by external clients would pollute traces.
+				requestID = ""
+			}
+			if requestID == "" {
+				requestID = newRequestID()
+			}
+			// The ID lives in the context (like the user ID) so the proxy
+			// can set it on the outbound request without depending on
+			// inbound-header mutation order; the inbound header is still
+			// set for any handler that only looks there.
+			r = r.WithContext(context.WithValue(r.Context(), requestIDKey, requestID))
+			r.Header.Set("X-Request-ID", requestID)
+			w.Header().Set("X-Request-ID", requestID)
+
+			var inner http.ResponseWriter = w
+			if cfg.GatewayDurationHeader {
+				inner = &durationWriter{ResponseWriter: w, start: start}
+			}
+			rw := NewResponseRecorder(inner)
+			next.ServeHTTP(rw, r)
+
+			duration := time.Since(start)
+			if !shouldLog(cfg, rw.Status(), duration) {
+				return
+			}
+
+			entry := map[string]interface{}{
+				"timestamp":      start.UTC().Format(time.RFC3339Nano),
+				"request_id":     requestID,
+				"method":         r.Method,
+				"path":           loggedPath(r, cfg),
+				"route":          routeTemplate(r.URL.Path),
+				"status":         rw.Status(),
+				"duration_ms":    duration.Milliseconds(),
+				"remote_addr":    r.RemoteAddr,
+				"request_bytes":  requestBytes(r),
+				"response_bytes": rw.BytesWritten(),
+			}
+			if userID := r.Header.Get("X-User-ID"); userID != "" {
+				entry["user_id"] = userID
+			}
+			if ct := rw.Header().Get("Content-Type"); ct != "" {
+				entry["content_type"] = ct
+			}
+			if allowed != nil {
+				for field := range entry {
+					if !allowed[field] {
+						delete(entry, field)
+					}
+				}
+			}
+			if b, err := json.Marshal(entry); err == nil {
+				if out != nil {
+					out.Write(append(b, '\n'))
+				} else {
+					log.Println(string(b))
+				}
+			}
+		})
+	}
+}
+
+// shouldLog applies LOG_SAMPLE_RATE to successful responses. Errors (4xx
+// and up) and requests slower than LOG_SLOW_THRESHOLD_MS always log; the
+// rest are kept with probability LogSampleRate. Sampling only engages for
+// rates strictly between 0 and 1, so a zero-value config logs everything.
+func shouldLog(cfg *config.Config, status int, duration time.Duration) bool {
+	if cfg.LogSampleRate <= 0 || cfg.LogSampleRate >= 1 || status >= http.StatusBadRequest {
+		return true
+	}
+	if cfg.LogSlowThresholdMS > 0 && duration.Milliseconds() > int64(cfg.LogSlowThresholdMS) {
+		return true
+	}
+	return mrand.Float64() < cfg.LogSampleRate
+}
+
+// routeTemplate reduces a request path to its matched route prefix: API
+// requests group under /api/<service>, everything else (health probes,
+// admin routes) is already low-cardinality and passes through unchanged.
+func routeTemplate(path string) string {
+	if name := serviceFromPath(path); name != "" {
+		return "/api/" + name
+	}
+	return path
+}
+
+// loggedPath returns the path as it should appear in the access log. For
+// services marked LOG_REDACT the detailed path (which may embed sensitive
+// identifiers) collapses to /api/<service>/*.
+func loggedPath(r *http.Request, cfg *config.Config) string {
+	if name := serviceFromPath(r.URL.Path); name != "" {
+		if svc, ok := cfg.Services[name]; ok && svc.LogRedact {
+			return "/api/" + name + "/*"
+		}
+	}
+	return r.URL.Path
+}
+
+// requestBytes reports the inbound body size, treating an unknown
+// Content-Length as zero.
+func requestBytes(r *http.Request) int64 {
+	if r.ContentLength > 0 {
+		return r.ContentLength
+	}
+	return 0
+}
+
+// logFieldSet turns the LOG_FIELDS list into a lookup set; nil means all
+// fields are emitted.
+func logFieldSet(fields []string) map[string]bool {
+	if len(fields) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		set[f] = true
+	}
+	return set
+}
+
+// newRequestID returns a 16-byte random hex ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,333 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// captureLog redirects the standard logger for the duration of the test and
+// returns the buffer it writes to.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+	return &buf
+}
+
+// lastLogEntry parses the final JSON object logged into buf.
+func lastLogEntry(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	last := lines[len(lines)-1]
+	idx := strings.Index(last, "{")
+	if idx < 0 {
+		t.Fatalf("no JSON object in log line %q", last)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(last[idx:]), &entry); err != nil {
+		t.Fatalf("parsing log entry %q: %v", last, err)
+	}
+	return entry
+}
+
+func TestLoggingEmitsAllFieldsByDefault(t *testing.T) {
+	buf := captureLog(t)
+
+	handler := LoggingMiddleware(&config.Config{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+
+	entry := lastLogEntry(t, buf)
+	for _, field := range []string{"timestamp", "request_id", "method", "path", "status", "duration_ms", "remote_addr"} {
+		if _, ok := entry[field]; !ok {
+			t.Errorf("default log entry missing %q", field)
+		}
+	}
+	if entry["status"].(float64) != http.StatusTeapot {
+		t.Errorf("status = %v, want 418", entry["status"])
+	}
+}
+
+func TestLoggingHonorsFieldAllowList(t *testing.T) {
+	buf := captureLog(t)
+
+	cfg := &config.Config{LogFields: []string{"method", "status"}}
+	handler := LoggingMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/x", nil)
+	req.Header.Set("X-User-ID", "user-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entry := lastLogEntry(t, buf)
+	if len(entry) != 2 {
+		t.Fatalf("entry has %d fields %v, want only method and status", len(entry), entry)
+	}
+	if _, ok := entry["user_id"]; ok {
+		t.Error("user_id should have been omitted")
+	}
+	if _, ok := entry["duration_ms"]; ok {
+		t.Error("duration_ms should have been omitted")
+	}
+}
+
+func TestRequestIDReachesBackendViaContext(t *testing.T) {
+	captureLog(t)
+
+	var seen string
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = GetRequestID(r)
+	})
+
+	// Order shouldn't matter: the ID travels in the context, not just the
+	// mutated inbound header.
+	handler := AuthMiddleware(&config.Config{})(LoggingMiddleware(&config.Config{})(inner))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+	if seen == "" {
+		t.Fatal("GetRequestID empty with auth wrapped outside logging")
+	}
+
+	seen = ""
+	handler = LoggingMiddleware(&config.Config{})(AuthMiddleware(&config.Config{})(inner))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+	if seen == "" {
+		t.Fatal("GetRequestID empty with logging wrapped outside auth")
+	}
+}
+
+func TestLoggingRecordsByteCounts(t *testing.T) {
+	buf := captureLog(t)
+
+	body := strings.Repeat("x", 37)
+	handler := LoggingMiddleware(&config.Config{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello, world"))
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/api/agent/x", strings.NewReader(body))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entry := lastLogEntry(t, buf)
+	if got := entry["request_bytes"].(float64); got != 37 {
+		t.Errorf("request_bytes = %v, want 37", got)
+	}
+	if got := entry["response_bytes"].(float64); got != float64(len("hello, world")) {
+		t.Errorf("response_bytes = %v, want %d", got, len("hello, world"))
+	}
+}
+
+func TestRequestIDTrustedOnly(t *testing.T) {
+	_, trusted, _ := net.ParseCIDR("10.0.0.0/8")
+	cfg := &config.Config{
+		RequestIDTrustedOnly: true,
+		TrustedProxies:       []*net.IPNet{trusted},
+	}
+	handler := LoggingMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// From a trusted proxy the inbound ID is honored.
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/x", nil)
+	req.RemoteAddr = "10.1.2.3:4567"
+	req.Header.Set("X-Request-ID", "upstream-id")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Request-ID"); got != "upstream-id" {
+		t.Errorf("trusted proxy: request ID = %q, want upstream-id", got)
+	}
+
+	// From anywhere else a fresh ID replaces the inbound one.
+	req = httptest.NewRequest(http.MethodGet, "/api/agent/x", nil)
+	req.RemoteAddr = "203.0.113.9:4567"
+	req.Header.Set("X-Request-ID", "spoofed-id")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Request-ID"); got == "spoofed-id" || got == "" {
+		t.Errorf("untrusted client: request ID = %q, want a freshly generated one", got)
+	}
+}
+
+func TestGatewayDurationHeader(t *testing.T) {
+	cfg := &config.Config{GatewayDurationHeader: true}
+	handler := LoggingMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+
+	got := rec.Header().Get("X-Gateway-Duration-Ms")
+	if got == "" {
+		t.Fatal("X-Gateway-Duration-Ms header missing")
+	}
+	ms, err := strconv.Atoi(got)
+	if err != nil {
+		t.Fatalf("header %q is not numeric", got)
+	}
+	if ms < 25 || ms > 500 {
+		t.Errorf("duration %dms does not approximate the ~30ms handler", ms)
+	}
+
+	// Off by default.
+	rec = httptest.NewRecorder()
+	plain := LoggingMiddleware(&config.Config{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	plain.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+	if rec.Header().Get("X-Gateway-Duration-Ms") != "" {
+		t.Error("header present without GATEWAY_DURATION_HEADER")
+	}
+}
+
+func TestLogRedactCollapsesServicePath(t *testing.T) {
+	buf := captureLog(t)
+
+	cfg := &config.Config{Services: map[string]*config.ServiceConfig{
+		"llm":   {Name: "llm", LogRedact: true},
+		"agent": {Name: "agent"},
+	}}
+	handler := LoggingMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	handler.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/api/llm/generate/secret-prompt-id?q=sensitive", nil))
+	entry := lastLogEntry(t, buf)
+	if got := entry["path"]; got != "/api/llm/*" {
+		t.Errorf("redacted path = %v, want /api/llm/*", got)
+	}
+	if strings.Contains(buf.String(), "secret-prompt-id") || strings.Contains(buf.String(), "sensitive") {
+		t.Errorf("log leaked redacted detail: %s", buf.String())
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodGet, "/api/agent/run/42", nil))
+	entry = lastLogEntry(t, buf)
+	if got := entry["path"]; got != "/api/agent/run/42" {
+		t.Errorf("agent path = %v, want full path logged", got)
+	}
+}
+
+func TestLogSamplingAlwaysKeepsErrors(t *testing.T) {
+	buf := captureLog(t)
+
+	cfg := &config.Config{LogSampleRate: 0.001}
+	handler := LoggingMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	for i := 0; i < 20; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 20 {
+		t.Fatalf("logged %d of 20 error responses, want all", len(lines))
+	}
+}
+
+func TestLogSamplingRateApproximatelyHonored(t *testing.T) {
+	buf := captureLog(t)
+
+	cfg := &config.Config{LogSampleRate: 0.2}
+	handler := LoggingMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 1000; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+	}
+
+	logged := len(strings.Split(strings.TrimSpace(buf.String()), "\n"))
+	if buf.Len() == 0 {
+		logged = 0
+	}
+	if logged < 120 || logged > 300 {
+		t.Fatalf("logged %d of 1000 successes at rate 0.2, want roughly 200", logged)
+	}
+}
+
+func TestLogSamplingAlwaysKeepsSlowRequests(t *testing.T) {
+	buf := captureLog(t)
+
+	cfg := &config.Config{LogSampleRate: 0.001, LogSlowThresholdMS: 5}
+	handler := LoggingMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(15 * time.Millisecond)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+
+	if buf.Len() == 0 {
+		t.Fatal("slow request was sampled out, want always logged")
+	}
+}
+
+func TestLoggingRecordsContentType(t *testing.T) {
+	buf := captureLog(t)
+
+	handler := LoggingMiddleware(&config.Config{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+
+	entry := lastLogEntry(t, buf)
+	if got := entry["content_type"]; got != "application/json" {
+		t.Errorf("content_type = %v, want application/json", got)
+	}
+}
+
+func TestFlushPropagatesThroughLogging(t *testing.T) {
+	captureLog(t)
+
+	underlying := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	cfg := &config.Config{GatewayDurationHeader: true}
+	handler := LoggingMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+	}))
+	handler.ServeHTTP(underlying, httptest.NewRequest(http.MethodGet, "/api/llm/stream", nil))
+
+	if underlying.flushes != 1 {
+		t.Fatalf("flushes = %d, want 1 reaching the underlying writer", underlying.flushes)
+	}
+}
+
+func TestHijackPropagatesThroughLogging(t *testing.T) {
+	captureLog(t)
+
+	underlying := &hijackWriter{ResponseRecorder: httptest.NewRecorder()}
+	cfg := &config.Config{GatewayDurationHeader: true}
+	handler := LoggingMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+			t.Errorf("Hijack through logging chain: %v", err)
+		}
+	}))
+	handler.ServeHTTP(underlying, httptest.NewRequest(http.MethodGet, "/api/agent/ws", nil))
+
+	if !underlying.hijacked {
+		t.Fatal("hijack did not reach the underlying writer")
+	}
+}
+
+func TestRouteTemplateLoggedForAPIRequests(t *testing.T) {
+	buf := captureLog(t)
+
+	handler := LoggingMiddleware(&config.Config{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodGet, "/api/agent/chat/123", nil))
+
+	entry := lastLogEntry(t, buf)
+	if got := entry["route"]; got != "/api/agent" {
+		t.Errorf("route = %v, want /api/agent", got)
+	}
+	if got := entry["path"]; got != "/api/agent/chat/123" {
+		t.Errorf("path = %v, want the concrete path preserved", got)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	entry = lastLogEntry(t, buf)
+	if got := entry["route"]; got != "/health" {
+		t.Errorf("non-API route = %v, want /health", got)
+	}
+}
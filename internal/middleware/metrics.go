@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/metrics"
+)
+
+// MetricsMiddleware feeds completed /api/ request outcomes into the
+// aggregate collector; other routes (health probes, admin) are not counted.
+// Request bodies are counted as the proxy consumes them and responses via
+// the byte-counting recorder, feeding the per-service size histograms.
+func MetricsMiddleware(c *metrics.Collector) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			body := &countingReader{rc: r.Body}
+			if r.Body != nil {
+				r.Body = body
+			}
+			rw := NewResponseRecorder(w)
+			next.ServeHTTP(rw, r)
+			service := serviceFromPath(r.URL.Path)
+			c.RecordRequest(service, rw.Status())
+			c.RecordSizes(service, body.n, rw.BytesWritten())
+		})
+	}
+}
+
+// countingReader counts request-body bytes as the handler chain reads them.
+type countingReader struct {
+	rc io.ReadCloser
+	n  int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.rc.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func (cr *countingReader) Close() error { return cr.rc.Close() }
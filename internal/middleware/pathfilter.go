@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// PathFilterMiddleware enforces PATH_DENYLIST and PATH_ALLOWLIST on /api
+// routes: a path matching the denylist is refused, and when an allowlist is
+// configured anything outside it is refused too. The denylist wins when
+// both match. Non-API routes (health probes, /gateway admin) are never
+// filtered. The router installs this after path normalization, so patterns
+// are matched against the same canonical path the proxy forwards.
+func PathFilterMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				if matchesAny(cfg.PathDenylist, r.URL.Path) {
+					writeAuthError(w, http.StatusForbidden, "forbidden")
+					return
+				}
+				if len(cfg.PathAllowlist) > 0 && !matchesAny(cfg.PathAllowlist, r.URL.Path) {
+					writeAuthError(w, http.StatusForbidden, "forbidden")
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// matchesAny reports whether p matches one of the glob patterns. Patterns
+// use path.Match syntax, where * stops at slashes; a trailing /* also
+// matches the whole subtree, so /api/agent/internal/* covers
+// /api/agent/internal/a/b.
+func matchesAny(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, p); err == nil && ok {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(p, pattern[:len(pattern)-1]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+func filterStatus(t *testing.T, cfg *config.Config, path string) int {
+	t.Helper()
+	handler := PathFilterMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code
+}
+
+func TestPathDenylistBlocksSubtrees(t *testing.T) {
+	cfg := &config.Config{PathDenylist: []string{"/api/agent/internal/*", "/api/rag/admin"}}
+
+	cases := map[string]int{
+		"/api/agent/internal/keys":     http.StatusForbidden,
+		"/api/agent/internal/a/b":      http.StatusForbidden,
+		"/api/rag/admin":               http.StatusForbidden,
+		"/api/agent/chat":              http.StatusOK,
+		"/api/rag/administrative-docs": http.StatusOK,
+		"/health":                      http.StatusOK,
+	}
+	for path, want := range cases {
+		if got := filterStatus(t, cfg, path); got != want {
+			t.Errorf("%s: got %d, want %d", path, got, want)
+		}
+	}
+}
+
+func TestPathAllowlistRefusesEverythingElse(t *testing.T) {
+	cfg := &config.Config{PathAllowlist: []string{"/api/agent/chat", "/api/llm/*"}}
+
+	cases := map[string]int{
+		"/api/agent/chat":    http.StatusOK,
+		"/api/llm/complete":  http.StatusOK,
+		"/api/agent/other":   http.StatusForbidden,
+		"/api/rag/documents": http.StatusForbidden,
+		"/gateway/config":    http.StatusOK,
+	}
+	for path, want := range cases {
+		if got := filterStatus(t, cfg, path); got != want {
+			t.Errorf("%s: got %d, want %d", path, got, want)
+		}
+	}
+}
+
+func TestPathFilterDefaultIsOpen(t *testing.T) {
+	if got := filterStatus(t, &config.Config{}, "/api/agent/anything"); got != http.StatusOK {
+		t.Fatalf("unfiltered path: got %d, want 200", got)
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// PathNormalizeMiddleware enforces the PATH_NORMALIZE policy: "redirect"
+// sends clients a 308 to the canonical path, "rewrite" silently proxies the
+// canonical path. The canonical form collapses duplicate slashes and drops
+// the trailing slash, so /api/agent/foo and //api//agent//foo/ reach the
+// backend identically. The router only installs this when the mode is not
+// "off".
+func PathNormalizeMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			canonical := canonicalPath(r.URL.Path)
+			if canonical == r.URL.Path {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if cfg.PathNormalize == config.PathNormalizeRedirect {
+				target := canonical
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				// 308, not 301: clients rewrite a 301'd POST into a GET,
+				// which would drop the body on non-canonical write paths.
+				http.Redirect(w, r, target, http.StatusPermanentRedirect)
+				return
+			}
+			r.URL.Path = canonical
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// canonicalPath collapses runs of slashes and strips the trailing slash
+// (the root path stays "/").
+func canonicalPath(p string) string {
+	for strings.Contains(p, "//") {
+		p = strings.ReplaceAll(p, "//", "/")
+	}
+	if len(p) > 1 {
+		p = strings.TrimSuffix(p, "/")
+	}
+	if p == "" {
+		p = "/"
+	}
+	return p
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+func TestPathNormalizeRewrite(t *testing.T) {
+	cfg := &config.Config{PathNormalize: config.PathNormalizeRewrite}
+	var seen string
+	handler := PathNormalizeMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.URL.Path
+	}))
+
+	for raw, want := range map[string]string{
+		"//api//agent//x": "/api/agent/x",
+		"/api/agent/foo/": "/api/agent/foo",
+		"/api/agent/foo":  "/api/agent/foo",
+		"/":               "/",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, raw, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%q: got status %d, want 200 pass-through", raw, rec.Code)
+		}
+		if seen != want {
+			t.Errorf("%q normalized to %q, want %q", raw, seen, want)
+		}
+	}
+}
+
+func TestPathNormalizeRedirect(t *testing.T) {
+	cfg := &config.Config{PathNormalize: config.PathNormalizeRedirect}
+	handler := PathNormalizeMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "//api//agent//x/?q=1", nil))
+	if rec.Code != http.StatusPermanentRedirect {
+		t.Fatalf("got status %d, want 308", rec.Code)
+	}
+
+	if got := rec.Header().Get("Location"); got != "/api/agent/x?q=1" {
+		t.Errorf("Location = %q, want /api/agent/x?q=1", got)
+	}
+
+	// 308 preserves the method: a redirected POST must stay a POST, where
+	// a 301 would let clients retry it as a GET without the body.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "//api//llm//generate", nil))
+	if rec.Code != http.StatusPermanentRedirect {
+		t.Fatalf("POST: got status %d, want 308", rec.Code)
+	}
+
+	// An already-canonical path is served, not redirected.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("canonical path: got status %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// isPublicPath reports whether the request targets a PUBLIC_PATHS route,
+// which bypasses auth and the rate/concurrency limiters. Entries match
+// exactly, or by prefix when they end in '*'.
+func isPublicPath(r *http.Request, cfg *config.Config) bool {
+	for _, pattern := range cfg.PublicPaths {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		} else if r.URL.Path == pattern {
+			return true
+		}
+	}
+	return false
+}
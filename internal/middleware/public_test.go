@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+func TestPublicPathsBypassAuthAndRateLimit(t *testing.T) {
+	cfg := &config.Config{
+		SupabaseJWTSecret: "secret",
+		PublicPaths:       []string{"/metrics*", "/favicon.ico"},
+		RateLimitRequests: 60,
+	}
+	rl := NewRateLimiter(1, 1)
+	var sawUser string
+	handler := AuthMiddleware(cfg)(RateLimitMiddleware(cfg, rl)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sawUser = GetUserID(r)
+	})))
+
+	// Prefix match: repeated unauthenticated hits sail through both
+	// middlewares even with an exhausted rate limit.
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics/summary", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("public prefix hit %d: got status %d, want 200", i+1, rec.Code)
+		}
+	}
+	if sawUser != "" {
+		t.Errorf("public path resolved user %q, want none", sawUser)
+	}
+
+	// Exact match.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("exact public path: got status %d, want 200", rec.Code)
+	}
+
+	// Everything else still goes through the stack.
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/run", nil)
+	req.Header.Set("Authorization", "Bearer garbage")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("non-public path with bad token: got status %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/quota"
+)
+
+// QuotaMiddleware enforces hard per-user, per-service usage quotas on the
+// /api/ routes, returning 429 with an X-Quota-Reset header (unix seconds)
+// when a user has exhausted their allowance for the period.
+func QuotaMiddleware(tracker *quota.Tracker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			service := serviceFromPath(r.URL.Path)
+			if service == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed, reset, err := tracker.Allow(GetUserID(r), service)
+			if err != nil {
+				log.Printf("quota store error (failing open): %v", err)
+			}
+			if !allowed {
+				w.Header().Set("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
+				writeAuthError(w, http.StatusTooManyRequests, "usage quota exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// serviceFromPath extracts the service segment from /api/<service>/...,
+// returning "" for non-API paths.
+func serviceFromPath(path string) string {
+	rest, ok := strings.CutPrefix(path, "/api/")
+	if !ok {
+		return ""
+	}
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		rest = rest[:i]
+	}
+	return rest
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/quota"
+)
+
+// quotaRequest issues a request through the quota middleware as userID.
+func quotaRequest(handler http.Handler, userID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil)
+	req = req.WithContext(context.WithValue(req.Context(), userIDKey, userID))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestQuotaBlocksAfterLimitAndResets(t *testing.T) {
+	tracker := quota.NewTracker(quota.NewMemoryStore(), 3, 200*time.Millisecond)
+	handler := QuotaMiddleware(tracker)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Sit at the start of a window so the test doesn't straddle a reset.
+	time.Sleep(time.Until(time.Now().Truncate(200 * time.Millisecond).Add(200 * time.Millisecond)))
+
+	for i := 0; i < 3; i++ {
+		if rec := quotaRequest(handler, "user-1"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want 200", i, rec.Code)
+		}
+	}
+
+	rec := quotaRequest(handler, "user-1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("over quota: got status %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("X-Quota-Reset") == "" {
+		t.Fatal("429 should carry X-Quota-Reset")
+	}
+
+	// Another user is unaffected.
+	if rec := quotaRequest(handler, "user-2"); rec.Code != http.StatusOK {
+		t.Fatalf("other user: got status %d, want 200", rec.Code)
+	}
+
+	// After the period boundary the user is allowed again.
+	time.Sleep(250 * time.Millisecond)
+	if rec := quotaRequest(handler, "user-1"); rec.Code != http.StatusOK {
+		t.Fatalf("after reset: got status %d, want 200", rec.Code)
+	}
+}
+
+func TestQuotaIgnoresNonAPIRoutes(t *testing.T) {
+	tracker := quota.NewTracker(quota.NewMemoryStore(), 1, time.Hour)
+	handler := QuotaMiddleware(tracker)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("health request %d: got status %d, want 200", i, rec.Code)
+		}
+	}
+}
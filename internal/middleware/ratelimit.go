@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/liveness"
+)
+
+// TokenBucket is a single client's rate-limit state.
+type TokenBucket struct {
+	mu         sync.Mutex
+	tokens     float64
+	capacity   float64
+	refillRate float64 // tokens per second
+	lastUpdate time.Time
+
+	// now is the clock source, injectable for tests; time.Now carries a
+	// monotonic reading, which Sub preserves.
+	now func() time.Time
+}
+
+// NewTokenBucket returns a full bucket refilling at ratePerMinute.
+func NewTokenBucket(ratePerMinute, burst int) *TokenBucket {
+	return &TokenBucket{
+		tokens:     float64(burst),
+		capacity:   float64(burst),
+		refillRate: float64(ratePerMinute) / 60.0,
+		lastUpdate: time.Now(),
+		now:        time.Now,
+	}
+}
+
+// Allow consumes a token if one is available.
+func (tb *TokenBucket) Allow() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.now()
+	elapsed := now.Sub(tb.lastUpdate).Seconds()
+	tb.lastUpdate = now
+
+	// A backward clock jump (e.g. an NTP step on a clock source without a
+	// monotonic reading) must not drain tokens.
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	tb.tokens += elapsed * tb.refillRate
+	if tb.tokens > tb.capacity {
+		tb.tokens = tb.capacity
+	}
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+// RateLimiter tracks per-client token buckets and sweeps idle ones.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*TokenBucket
+	seen    map[string]time.Time
+
+	rate  int
+	burst int
+
+	// anonRate and anonBurst, when non-zero, apply to anonymous-* keys
+	// instead of the standard parameters.
+	anonRate  int
+	anonBurst int
+
+	// writeRate and writeBurst, when non-zero, apply to the separate
+	// write-method buckets (keys carrying the writeKeySuffix).
+	writeRate  int
+	writeBurst int
+}
+
+// writeKeySuffix marks the per-user bucket for mutating methods, keeping it
+// isolated from the same user's read bucket.
+const writeKeySuffix = "|write"
+
+// NewRateLimiter returns a limiter with the given per-minute rate and burst,
+// and starts a background sweeper for idle buckets.
+func NewRateLimiter(ratePerMinute, burst int) *RateLimiter {
+	rl := &RateLimiter{
+		buckets: make(map[string]*TokenBucket),
+		seen:    make(map[string]time.Time),
+		rate:    ratePerMinute,
+		burst:   burst,
+	}
+	go rl.sweep()
+	return rl
+}
+
+// SetAnonLimits gives anonymous clients their own rate and burst; zero
+// values keep the standard parameters.
+func (rl *RateLimiter) SetAnonLimits(ratePerMinute, burst int) {
+	rl.mu.Lock()
+	rl.anonRate = ratePerMinute
+	rl.anonBurst = burst
+	rl.mu.Unlock()
+}
+
+// SetWriteLimits gives mutating methods (POST/PUT/PATCH/DELETE) their own,
+// typically stricter, rate and burst; zero values disable the split.
+func (rl *RateLimiter) SetWriteLimits(ratePerMinute, burst int) {
+	rl.mu.Lock()
+	rl.writeRate = ratePerMinute
+	rl.writeBurst = burst
+	rl.mu.Unlock()
+}
+
+// Allow reports whether the client identified by key may proceed.
+func (rl *RateLimiter) Allow(key string) bool {
+	rl.mu.Lock()
+	tb, ok := rl.buckets[key]
+	if !ok {
+		rate, burst := rl.rate, rl.burst
+		switch {
+		case rl.writeRate > 0 && strings.HasSuffix(key, writeKeySuffix):
+			rate, burst = rl.writeRate, rl.writeBurst
+		case rl.anonRate > 0 && strings.HasPrefix(key, "anonymous-"):
+			rate, burst = rl.anonRate, rl.anonBurst
+		}
+		tb = NewTokenBucket(rate, burst)
+		rl.buckets[key] = tb
+	}
+	rl.seen[key] = time.Now()
+	rl.mu.Unlock()
+	return tb.Allow()
+}
+
+// sweep periodically drops buckets idle for more than ten minutes, beating
+// the liveness registry each pass so /health notices if this loop dies.
+func (rl *RateLimiter) sweep() {
+	liveness.Register("ratelimit-sweeper")
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		liveness.Beat("ratelimit-sweeper")
+		cutoff := time.Now().Add(-10 * time.Minute)
+		rl.mu.Lock()
+		for key, last := range rl.seen {
+			if last.Before(cutoff) {
+				delete(rl.buckets, key)
+				delete(rl.seen, key)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
+
+// RateLimitMiddleware enforces per-user request rates, keyed on the resolved
+// user ID with the remote address as a fallback.
+func RateLimitMiddleware(cfg *config.Config, rl *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Public routes are never rate limited.
+			if isPublicPath(r, cfg) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := GetUserID(r)
+			if key == "" {
+				key = ClientIP(r, cfg)
+			}
+			// Anonymous callers can optionally share a bucket per subnet,
+			// so rotating through adjacent IPs doesn't mint fresh buckets.
+			if strings.HasPrefix(key, "anonymous-") {
+				if sk := subnetKey(r, cfg); sk != "" {
+					key = sk
+				}
+			}
+			// Mutating methods draw from their own, stricter bucket when
+			// write limits are configured; reads keep the standard one.
+			if cfg.RateLimitWriteRequests > 0 && isWriteMethod(r.Method) {
+				key += writeKeySuffix
+			}
+
+			if !rl.Allow(key) {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(cfg)))
+				writeAuthError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isWriteMethod reports whether the method mutates state for rate-limit
+// purposes.
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// subnetKey aggregates the client IP into its configured subnet bucket,
+// returning "" when aggregation is off for the address family. The
+// anonymous- prefix is kept so the anonymous limits still apply.
+func subnetKey(r *http.Request, cfg *config.Config) string {
+	ip := net.ParseIP(ClientIP(r, cfg))
+	if ip == nil {
+		return ""
+	}
+	bits, masked := 0, 128
+	if v4 := ip.To4(); v4 != nil {
+		ip, masked = v4, 32
+		bits = cfg.RateLimitSubnetV4
+	} else {
+		bits = cfg.RateLimitSubnetV6
+	}
+	if bits <= 0 || bits > masked {
+		return ""
+	}
+	network := ip.Mask(net.CIDRMask(bits, masked))
+	return "anonymous-net-" + network.String() + "/" + strconv.Itoa(bits)
+}
+
+// retryAfterSeconds estimates how long until a token is available.
+func retryAfterSeconds(cfg *config.Config) int {
+	if cfg.RateLimitRequests <= 0 {
+		return 60
+	}
+	secs := 60 / cfg.RateLimitRequests
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
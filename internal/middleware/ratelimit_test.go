@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// rateLimitedChain builds auth + rate limiting with a tiny per-client
+// budget so a second request from the same client is rejected.
+func rateLimitedChain(cfg *config.Config) http.Handler {
+	rl := NewRateLimiter(1, 1)
+	return AuthMiddleware(cfg)(RateLimitMiddleware(cfg, rl)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+}
+
+func doRateLimited(handler http.Handler, remoteAddr, xff string) int {
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/x", nil)
+	req.RemoteAddr = remoteAddr
+	if xff != "" {
+		req.Header.Set("X-Forwarded-For", xff)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestRateLimitUsesForwardedIPBehindTrustedProxy(t *testing.T) {
+	_, lbNet, _ := net.ParseCIDR("10.0.0.0/8")
+	cfg := &config.Config{RateLimitRequests: 1, TrustedProxies: []*net.IPNet{lbNet}}
+	handler := rateLimitedChain(cfg)
+
+	// Two distinct clients behind the same LB get their own buckets.
+	if code := doRateLimited(handler, "10.0.0.7:1", "1.2.3.4"); code != http.StatusOK {
+		t.Fatalf("client A first request: got %d, want 200", code)
+	}
+	if code := doRateLimited(handler, "10.0.0.7:2", "5.6.7.8"); code != http.StatusOK {
+		t.Fatalf("client B first request: got %d, want 200", code)
+	}
+	if code := doRateLimited(handler, "10.0.0.7:3", "1.2.3.4"); code != http.StatusTooManyRequests {
+		t.Fatalf("client A second request: got %d, want 429", code)
+	}
+}
+
+func TestRateLimitIgnoresSpoofedHeadersFromUntrustedSource(t *testing.T) {
+	cfg := &config.Config{RateLimitRequests: 1}
+	handler := rateLimitedChain(cfg)
+
+	// Rotating X-Forwarded-For from an untrusted peer must not grant new
+	// buckets: the peer IP is the key.
+	if code := doRateLimited(handler, "9.9.9.9:1", "1.1.1.1"); code != http.StatusOK {
+		t.Fatalf("first request: got %d, want 200", code)
+	}
+	if code := doRateLimited(handler, "9.9.9.9:2", "2.2.2.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("second request with rotated XFF: got %d, want 429", code)
+	}
+}
+
+func TestTokenBucketSurvivesBackwardClockJump(t *testing.T) {
+	tb := NewTokenBucket(60, 5)
+
+	// Simulate a clock that steps one minute into the past.
+	base := time.Now()
+	jumped := false
+	tb.now = func() time.Time {
+		if jumped {
+			return base.Add(-time.Minute)
+		}
+		return base
+	}
+
+	if !tb.Allow() {
+		t.Fatal("first request should pass")
+	}
+	jumped = true
+	for i := 0; i < 4; i++ {
+		if !tb.Allow() {
+			t.Fatalf("request %d after backward jump should still have burst tokens", i)
+		}
+	}
+	tb.mu.Lock()
+	tokens := tb.tokens
+	tb.mu.Unlock()
+	if tokens < 0 {
+		t.Fatalf("tokens went negative (%v) after backward clock jump", tokens)
+	}
+}
+
+func TestAnonymousUsersGetLowerLimit(t *testing.T) {
+	rl := NewRateLimiter(60, 5)
+	rl.SetAnonLimits(60, 1)
+
+	// The anonymous bucket drains after a single request.
+	if !rl.Allow("anonymous-203.0.113.9") {
+		t.Fatal("first anonymous request should pass")
+	}
+	if rl.Allow("anonymous-203.0.113.9") {
+		t.Error("second anonymous request should be limited")
+	}
+
+	// An identified user keeps the full burst.
+	for i := 0; i < 5; i++ {
+		if !rl.Allow("user-1") {
+			t.Fatalf("identified request %d should pass", i+1)
+		}
+	}
+	if rl.Allow("user-1") {
+		t.Error("identified user should be limited only after the full burst")
+	}
+}
+
+func TestSubnetModeSharesBucketAcrossIPs(t *testing.T) {
+	cfg := &config.Config{RateLimitRequests: 60, RateLimitSubnetV4: 24}
+	rl := NewRateLimiter(60, 1)
+	handler := AuthMiddleware(cfg)(RateLimitMiddleware(cfg, rl)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	send := func(ip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/agent/x", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if got := send("203.0.113.5"); got != http.StatusOK {
+		t.Fatalf("first request: %d, want 200", got)
+	}
+	// A different IP in the same /24 shares the drained bucket.
+	if got := send("203.0.113.200"); got != http.StatusTooManyRequests {
+		t.Fatalf("same /24: %d, want 429 (shared bucket)", got)
+	}
+	// A different /24 gets its own bucket.
+	if got := send("203.0.114.5"); got != http.StatusOK {
+		t.Fatalf("different /24: %d, want 200", got)
+	}
+}
+
+func TestSubnetModeOffKeysIndividualIPs(t *testing.T) {
+	cfg := &config.Config{RateLimitRequests: 60}
+	rl := NewRateLimiter(60, 1)
+	handler := AuthMiddleware(cfg)(RateLimitMiddleware(cfg, rl)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	for _, ip := range []string{"203.0.113.5", "203.0.113.200"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/agent/x", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("ip %s: %d, want 200 with per-IP buckets", ip, rec.Code)
+		}
+	}
+}
+
+func TestWriteLimitLeavesReadsAlone(t *testing.T) {
+	cfg := &config.Config{RateLimitRequests: 600, RateLimitBurst: 100, RateLimitWriteRequests: 1, RateLimitWriteBurst: 2}
+	rl := NewRateLimiter(cfg.RateLimitRequests, cfg.RateLimitBurst)
+	rl.SetWriteLimits(cfg.RateLimitWriteRequests, cfg.RateLimitWriteBurst)
+	handler := RateLimitMiddleware(cfg, rl)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(method string) int {
+		req := httptest.NewRequest(method, "/api/agent/items", nil)
+		req.RemoteAddr = "10.1.2.3:5555"
+		req.Header.Set("X-User-ID", "writer-1")
+		req = req.WithContext(context.WithValue(req.Context(), userIDKey, "writer-1"))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Exhaust the write burst.
+	for i := 0; i < 2; i++ {
+		if got := do(http.MethodPost); got != http.StatusOK {
+			t.Fatalf("write %d: got status %d, want 200", i, got)
+		}
+	}
+	if got := do(http.MethodDelete); got != http.StatusTooManyRequests {
+		t.Fatalf("write over budget: got status %d, want 429", got)
+	}
+
+	// Reads still flow from the standard bucket.
+	for i := 0; i < 5; i++ {
+		if got := do(http.MethodGet); got != http.StatusOK {
+			t.Fatalf("read %d after exhausted writes: got status %d, want 200", i, got)
+		}
+	}
+
+	// A different user's write budget is untouched.
+	req := httptest.NewRequest(http.MethodPost, "/api/agent/items", nil)
+	req.RemoteAddr = "10.1.2.4:5555"
+	req = req.WithContext(context.WithValue(req.Context(), userIDKey, "writer-2"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("second user's first write: got status %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// ResponseRecorder wraps a ResponseWriter, capturing the status code and
+// the number of body bytes written. It is the one wrapper shared by the
+// logging, metrics, debug, and proxy layers, so status-default semantics
+// stay consistent: an unwritten response reads as 200. Flush and Hijack
+// delegate to the underlying writer when it supports them, keeping
+// streaming responses and connection upgrades working through the wrap.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	status  int
+	bytes   int64
+	written bool
+}
+
+// NewResponseRecorder wraps w.
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	return &ResponseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rw *ResponseRecorder) WriteHeader(status int) {
+	// Informational 1xx responses pass through without latching: the real
+	// status follows them, so a forwarded 100 or 103 must not mark the
+	// response as written (or read back as the final status). 101 stays
+	// final — the connection upgrades and nothing else will be written.
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		rw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	rw.status = status
+	rw.written = true
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *ResponseRecorder) Write(b []byte) (int, error) {
+	rw.written = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Status returns the recorded status code; 200 when nothing was written.
+func (rw *ResponseRecorder) Status() int { return rw.status }
+
+// Written reports whether any header or body has gone out.
+func (rw *ResponseRecorder) Written() bool { return rw.written }
+
+// BytesWritten reports how many response body bytes have been written.
+func (rw *ResponseRecorder) BytesWritten() int64 { return rw.bytes }
+
+// Flush forwards to the underlying writer when it supports flushing.
+func (rw *ResponseRecorder) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack forwards to the underlying writer when it supports hijacking.
+func (rw *ResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := rw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap exposes the wrapped writer so http.ResponseController can reach
+// per-connection controls (deadlines, 1xx writes) through the recorder.
+func (rw *ResponseRecorder) Unwrap() http.ResponseWriter { return rw.ResponseWriter }
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// flushRecorder counts Flush calls on top of httptest.ResponseRecorder.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (f *flushRecorder) Flush() { f.flushes++ }
+
+// hijackWriter implements http.Hijacker, recording the call.
+type hijackWriter struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func TestResponseRecorderCapturesStatusAndBytes(t *testing.T) {
+	rec := NewResponseRecorder(httptest.NewRecorder())
+	if rec.Written() {
+		t.Error("fresh recorder reports written")
+	}
+	rec.WriteHeader(http.StatusAccepted)
+	rec.Write([]byte("hello"))
+	rec.Write([]byte(" world"))
+
+	if rec.Status() != http.StatusAccepted {
+		t.Errorf("Status = %d, want 202", rec.Status())
+	}
+	if rec.BytesWritten() != int64(len("hello world")) {
+		t.Errorf("BytesWritten = %d, want %d", rec.BytesWritten(), len("hello world"))
+	}
+	if !rec.Written() {
+		t.Error("recorder should report written")
+	}
+}
+
+func TestResponseRecorderDefaultsTo200(t *testing.T) {
+	rec := NewResponseRecorder(httptest.NewRecorder())
+	rec.Write([]byte("implicit"))
+	if rec.Status() != http.StatusOK {
+		t.Errorf("Status = %d, want implicit 200", rec.Status())
+	}
+}
+
+func TestResponseRecorderDelegatesFlush(t *testing.T) {
+	underlying := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rec := NewResponseRecorder(underlying)
+	rec.Flush()
+	if underlying.flushes != 1 {
+		t.Errorf("flushes = %d, want 1", underlying.flushes)
+	}
+	// A non-flushing writer must not panic.
+	NewResponseRecorder(nonFlusher{httptest.NewRecorder()}).Flush()
+}
+
+// nonFlusher hides ResponseRecorder's Flush method.
+type nonFlusher struct{ w *httptest.ResponseRecorder }
+
+func (n nonFlusher) Header() http.Header         { return n.w.Header() }
+func (n nonFlusher) Write(b []byte) (int, error) { return n.w.Write(b) }
+func (n nonFlusher) WriteHeader(status int)      { n.w.WriteHeader(status) }
+
+func TestResponseRecorderDelegatesHijack(t *testing.T) {
+	underlying := &hijackWriter{ResponseRecorder: httptest.NewRecorder()}
+	rec := NewResponseRecorder(underlying)
+	if _, _, err := rec.Hijack(); err != nil {
+		t.Fatalf("Hijack: %v", err)
+	}
+	if !underlying.hijacked {
+		t.Error("hijack did not reach the underlying writer")
+	}
+
+	if _, _, err := NewResponseRecorder(httptest.NewRecorder()).Hijack(); err == nil {
+		t.Error("expected error hijacking a non-hijackable writer")
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// RecoveryMiddleware converts panics in downstream handlers into 500
+// responses and logs the stack trace. The response defaults to a JSON error
+// envelope carrying the request ID so clients can quote it in bug reports;
+// PANIC_RESPONSE_BODY and PANIC_RESPONSE_CONTENT_TYPE override it for
+// deployments that need a bespoke payload.
+func RecoveryMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					// ErrAbortHandler is net/http's own abort signal —
+					// ReverseProxy raises it when the client goes away
+					// mid-body, routine for long streams. The server
+					// handles it quietly; re-raise rather than log a
+					// stack and write a 500 onto a dead connection.
+					if rec == http.ErrAbortHandler {
+						panic(rec)
+					}
+					log.Printf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, rec, debug.Stack())
+					contentType := cfg.PanicResponseContentType
+					if contentType == "" {
+						contentType = "application/json"
+					}
+					w.Header().Set("Content-Type", contentType)
+					w.WriteHeader(http.StatusInternalServerError)
+					if cfg.PanicResponseBody != "" {
+						io.WriteString(w, cfg.PanicResponseBody)
+						return
+					}
+					json.NewEncoder(w).Encode(map[string]string{
+						"error":      "internal server error",
+						"request_id": GetRequestID(r),
+					})
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
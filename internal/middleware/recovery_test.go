@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+func TestRecoveryDefaultsToJSONWithRequestID(t *testing.T) {
+	handler := RecoveryMiddleware(&config.Config{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/x", nil)
+	req = req.WithContext(context.WithValue(req.Context(), requestIDKey, "req-abc123"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want 500", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("panic response is not JSON: %v", err)
+	}
+	if body["error"] != "internal server error" {
+		t.Errorf("error = %q, want the generic envelope", body["error"])
+	}
+	if body["request_id"] != "req-abc123" {
+		t.Errorf("request_id = %q, want req-abc123", body["request_id"])
+	}
+}
+
+func TestRecoveryHonorsCustomBody(t *testing.T) {
+	cfg := &config.Config{
+		PanicResponseBody:        "<error>temporarily unavailable</error>",
+		PanicResponseContentType: "application/xml",
+	}
+	handler := RecoveryMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want 500", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/xml" {
+		t.Errorf("Content-Type = %q, want application/xml", ct)
+	}
+	if rec.Body.String() != cfg.PanicResponseBody {
+		t.Errorf("body = %q, want the configured payload", rec.Body.String())
+	}
+}
+
+func TestRecoveryRepanicsOnAbortHandler(t *testing.T) {
+	handler := RecoveryMiddleware(&config.Config{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if recover() != http.ErrAbortHandler {
+			t.Fatal("ErrAbortHandler must propagate to the server, not become a 500")
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/llm/stream", nil))
+	t.Fatal("handler returned instead of re-panicking")
+}
@@ -0,0 +1,62 @@
+// Package netlimit caps how many connections a listener will serve at once,
+// shielding the gateway from connection-exhaustion floods that per-request
+// rate limiting never sees.
+package netlimit
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Listener wraps a net.Listener with a connection cap: connections past the
+// cap are accepted and immediately closed instead of queueing, so an idle-
+// connection flood can't pin the accept loop.
+type Listener struct {
+	net.Listener
+	sem    chan struct{}
+	active atomic.Int64
+}
+
+// Limit caps l at n concurrent connections.
+func Limit(l net.Listener, n int) *Listener {
+	return &Listener{Listener: l, sem: make(chan struct{}, n)}
+}
+
+// Active returns the number of connections currently being served.
+func (l *Listener) Active() int {
+	return int(l.active.Load())
+}
+
+// Accept returns the next connection, closing it on the spot when the cap
+// is already reached.
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case l.sem <- struct{}{}:
+			l.active.Add(1)
+			return &limitedConn{Conn: conn, lis: l}, nil
+		default:
+			conn.Close()
+		}
+	}
+}
+
+// limitedConn releases its cap slot exactly once when closed.
+type limitedConn struct {
+	net.Conn
+	lis  *Listener
+	once sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(func() {
+		c.lis.active.Add(-1)
+		<-c.lis.sem
+	})
+	return c.Conn.Close()
+}
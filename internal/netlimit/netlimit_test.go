@@ -0,0 +1,74 @@
+package netlimit
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestExcessConnectionsAreRefused(t *testing.T) {
+	base, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis := Limit(base, 2)
+	defer lis.Close()
+
+	// A trivial echo-nothing server: hold each accepted connection open.
+	accepted := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", base.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return conn
+	}
+
+	c1, c2 := dial(), dial()
+	defer c1.Close()
+	defer c2.Close()
+	s1, s2 := <-accepted, <-accepted
+	defer s2.Close()
+	if got := lis.Active(); got != 2 {
+		t.Fatalf("Active = %d with two connections open, want 2", got)
+	}
+
+	// The third connection is closed immediately by the listener: the
+	// client sees EOF on its first read instead of a hung connection.
+	c3 := dial()
+	defer c3.Close()
+	c3.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := c3.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("over-cap connection read error = %v, want EOF", err)
+	}
+
+	// Closing a served connection frees its slot for the next client.
+	c1.Close()
+	s1.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for lis.Active() != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := lis.Active(); got != 1 {
+		t.Fatalf("Active = %d after releasing one connection, want 1", got)
+	}
+
+	c4 := dial()
+	defer c4.Close()
+	select {
+	case <-accepted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection after a freed slot was not accepted")
+	}
+}
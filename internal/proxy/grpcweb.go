@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/breaker"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/maintenance"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/middleware"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/reqlog"
+)
+
+// gRPC status codes the translator emits itself. Everything else passes
+// through from the upstream untouched.
+const (
+	grpcCodeDeadlineExceeded = 4
+	grpcCodeUnavailable      = 14
+)
+
+// trailerFrameFlag marks a gRPC-Web body frame as carrying trailers rather
+// than message data; data frames share gRPC's own 5-byte framing, so bodies
+// pass through the translator verbatim.
+const trailerFrameFlag = 0x80
+
+// GRPCWebHandler returns a handler translating browser gRPC-Web calls into
+// native gRPC for the upstream: the request body's framing is identical, so
+// translation means speaking HTTP/2 with trailers to the backend and folding
+// the response trailers into a gRPC-Web trailer frame (base64-wrapped for
+// the -text variant). Selected per service with <NAME>_PROTOCOL=grpc-web; it
+// sits behind the same auth chain and circuit breaker as ProxyHandler.
+//
+// The upstream must be reachable over HTTP/2 — an https URL with the shared
+// transport's ForceAttemptHTTP2, since cleartext h2c is not available in
+// this build.
+func GRPCWebHandler(svc *config.ServiceConfig, cb *breaker.CircuitBreaker, cfg *config.Config, rt http.RoundTripper) http.HandlerFunc {
+	target, err := url.Parse(svc.URL)
+	if err != nil {
+		log.Printf("invalid %s service URL %q: %v", svc.Name, svc.URL, err)
+		return func(w http.ResponseWriter, r *http.Request) {
+			writeJSONError(w, http.StatusInternalServerError, "service misconfigured")
+		}
+	}
+	prefix := "/api/" + svc.Name
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	client := &http.Client{Transport: rt}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		contentType, isText, ok := grpcWebContentType(r.Header.Get("Content-Type"))
+		if !ok {
+			writeJSONError(w, http.StatusUnsupportedMediaType, "expected a grpc-web content type")
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "grpc-web requires POST")
+			return
+		}
+
+		if maintenance.Default.Enabled(svc.Name) {
+			writeGRPCWebStatus(w, contentType, grpcCodeUnavailable, "service under maintenance")
+			return
+		}
+		if err := cb.Allow(); err != nil {
+			reqlog.Printf(r, svc.Name, "circuit breaker open, rejecting grpc-web request")
+			w.Header().Set("Retry-After", strconv.Itoa(int(cb.RetryAfter().Seconds())))
+			writeGRPCWebStatus(w, contentType, grpcCodeUnavailable, "service temporarily unavailable")
+			return
+		}
+
+		timeout := cfg.RequestTimeout
+		if svc.RequestTimeout > 0 {
+			timeout = svc.RequestTimeout
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		// The -text variant base64-wraps the whole body stream; underneath
+		// it is the same framing, so decoding restores a native gRPC body.
+		var body io.Reader = r.Body
+		if isText {
+			body = base64.NewDecoder(base64.StdEncoding, r.Body)
+		}
+
+		u := *target
+		u.Path = SingleJoiningSlash(target.Path, strings.TrimPrefix(r.URL.Path, prefix))
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+		if err != nil {
+			writeGRPCWebStatus(w, contentType, grpcCodeUnavailable, "upstream unavailable")
+			return
+		}
+		copyGRPCMetadata(req.Header, r.Header)
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("TE", "trailers")
+		if id := middleware.GetRequestID(r); id != "" {
+			req.Header.Set("X-Request-ID", id)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			cb.RecordFailure()
+			reqlog.Printf(r, svc.Name, "grpc-web upstream error: %v", err)
+			code := grpcCodeUnavailable
+			if errors.Is(err, context.DeadlineExceeded) {
+				code = grpcCodeDeadlineExceeded
+			}
+			writeGRPCWebStatus(w, contentType, code, "upstream unavailable")
+			return
+		}
+		defer resp.Body.Close()
+
+		w.Header().Set("Content-Type", contentType)
+		copyGRPCMetadata(w.Header(), resp.Header)
+		w.WriteHeader(resp.StatusCode)
+
+		var out io.Writer = w
+		var b64 io.WriteCloser
+		if isText {
+			b64 = base64.NewEncoder(base64.StdEncoding, w)
+			out = b64
+		}
+		// Data frames are byte-identical between the two protocols; trailers
+		// arrive after the body and become a flagged body frame.
+		if _, err := io.Copy(out, resp.Body); err != nil {
+			reqlog.Printf(r, svc.Name, "grpc-web response copy error: %v", err)
+		}
+		if len(resp.Trailer) > 0 {
+			writeTrailerFrame(out, resp.Trailer)
+		}
+		if b64 != nil {
+			b64.Close()
+		}
+
+		// A transport-level success still counts against the breaker when
+		// the upstream itself reports UNAVAILABLE.
+		if grpcStatus(resp) == grpcCodeUnavailable {
+			cb.RecordFailure()
+		} else {
+			cb.RecordSuccess()
+		}
+	}
+}
+
+// grpcWebContentType recognizes the gRPC-Web content types, reporting the
+// type to echo back and whether the base64 -text framing is in use.
+func grpcWebContentType(ct string) (echo string, isText, ok bool) {
+	base := ct
+	if i := strings.IndexByte(base, ';'); i >= 0 {
+		base = base[:i]
+	}
+	base = strings.TrimSpace(base)
+	switch base {
+	case "application/grpc-web", "application/grpc-web+proto":
+		return base, false, true
+	case "application/grpc-web-text", "application/grpc-web-text+proto":
+		return base, true, true
+	}
+	return "", false, false
+}
+
+// copyGRPCMetadata copies gRPC metadata headers between the browser- and
+// upstream-facing sides, skipping the transport-level headers each side
+// manages itself.
+func copyGRPCMetadata(dst, src http.Header) {
+	for name, values := range src {
+		switch strings.ToLower(name) {
+		case "content-type", "content-length", "te", "trailer", "accept-encoding", "connection":
+			continue
+		}
+		for _, v := range values {
+			dst.Add(name, v)
+		}
+	}
+}
+
+// writeGRPCWebStatus writes a trailers-only gRPC-Web response: a 200 with
+// the status carried in Grpc-Status/Grpc-Message headers and no body, which
+// is how gRPC surfaces errors the transport itself produced.
+func writeGRPCWebStatus(w http.ResponseWriter, contentType string, code int, message string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", message)
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeTrailerFrame folds HTTP trailers into the gRPC-Web trailer frame: a
+// body frame flagged 0x80 whose payload is "name: value\r\n" pairs.
+func writeTrailerFrame(w io.Writer, trailers http.Header) {
+	names := make([]string, 0, len(trailers))
+	for name := range trailers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var payload []byte
+	for _, name := range names {
+		for _, v := range trailers[name] {
+			payload = append(payload, strings.ToLower(name)...)
+			payload = append(payload, ": "...)
+			payload = append(payload, v...)
+			payload = append(payload, "\r\n"...)
+		}
+	}
+	var header [5]byte
+	header[0] = trailerFrameFlag
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	w.Write(header[:])
+	w.Write(payload)
+}
+
+// grpcStatus extracts the upstream's gRPC status code, preferring trailers
+// (the normal case) over headers (trailers-only responses). Absent or
+// malformed means OK as far as the breaker is concerned.
+func grpcStatus(resp *http.Response) int {
+	raw := resp.Trailer.Get("Grpc-Status")
+	if raw == "" {
+		raw = resp.Header.Get("Grpc-Status")
+	}
+	code, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0
+	}
+	return code
+}
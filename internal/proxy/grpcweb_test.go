@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/transport"
+)
+
+// grpcFrame wraps a message in gRPC's 5-byte framing.
+func grpcFrame(flag byte, msg []byte) []byte {
+	frame := make([]byte, 5+len(msg))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(msg)))
+	copy(frame[5:], msg)
+	return frame
+}
+
+// TestGRPCWebUnaryRoundTrip drives a unary call through the translator
+// against a fake native-gRPC backend speaking HTTP/2 with trailers.
+func TestGRPCWebUnaryRoundTrip(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("backend saw HTTP/%d, want HTTP/2", r.ProtoMajor)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/grpc" {
+			t.Errorf("backend Content-Type = %q, want application/grpc", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if len(body) < 5 {
+			t.Fatalf("backend got %d body bytes, want a framed message", len(body))
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.Write(grpcFrame(0, append([]byte("pong:"), body[5:]...)))
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("Grpc-Message", "")
+	}))
+	backend.EnableHTTP2 = true
+	backend.StartTLS()
+	defer backend.Close()
+
+	cfg := testConfig()
+	svc := testService("agent", backend.URL)
+	svc.Protocol = config.ProtocolGRPCWeb
+	handler := GRPCWebHandler(svc, newTestBreaker(), cfg, backend.Client().Transport)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/agent/echo.Echo/Ping",
+		bytes.NewReader(grpcFrame(0, []byte("ping"))))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/grpc-web+proto" {
+		t.Errorf("Content-Type = %q, want application/grpc-web+proto", ct)
+	}
+	body := rec.Body.Bytes()
+	wantData := grpcFrame(0, []byte("pong:ping"))
+	if len(body) < len(wantData) || !bytes.Equal(body[:len(wantData)], wantData) {
+		t.Fatalf("response does not start with the echoed data frame: %q", body)
+	}
+	trailer := body[len(wantData):]
+	if len(trailer) < 5 || trailer[0] != trailerFrameFlag {
+		t.Fatalf("data frame is not followed by a trailer frame: %q", trailer)
+	}
+	if !bytes.Contains(trailer[5:], []byte("grpc-status: 0")) {
+		t.Errorf("trailer frame %q missing grpc-status: 0", trailer[5:])
+	}
+}
+
+func TestGRPCWebOpenBreakerIsTrailersOnlyUnavailable(t *testing.T) {
+	cfg := testConfig()
+	svc := testService("agent", "https://agent.internal")
+	cb := newTestBreaker()
+	for i := 0; i < 5; i++ {
+		cb.RecordFailure()
+	}
+	handler := GRPCWebHandler(svc, cb, cfg, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/agent/echo.Echo/Ping", nil)
+	req.Header.Set("Content-Type", "application/grpc-web")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want a trailers-only 200", rec.Code)
+	}
+	if got := rec.Header().Get("Grpc-Status"); got != "14" {
+		t.Errorf("Grpc-Status = %q, want 14 (UNAVAILABLE)", got)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After on an open breaker")
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("trailers-only response carried %d body bytes", rec.Body.Len())
+	}
+}
+
+func TestGRPCWebRejectsNonGRPCContentType(t *testing.T) {
+	cfg := testConfig()
+	handler := GRPCWebHandler(testService("agent", "https://agent.internal"), newTestBreaker(), cfg, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/agent/echo.Echo/Ping", nil)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("got status %d, want 415", rec.Code)
+	}
+}
+
+// TestGRPCWebOverSharedTransport drives the translator through the shared
+// transport.New transport — the one newRouter actually wires in — which
+// must negotiate HTTP/2 with the backend despite its custom dialer.
+func TestGRPCWebOverSharedTransport(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("backend saw HTTP/%d, want HTTP/2", r.ProtoMajor)
+		}
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write(grpcFrame(0, []byte("pong")))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	backend.EnableHTTP2 = true
+	backend.StartTLS()
+	defer backend.Close()
+
+	cfg := testConfig()
+	tr := transport.New(cfg)
+	// Trust the test server's certificate; everything else is the
+	// production transport.
+	tr.TLSClientConfig = backend.Client().Transport.(*http.Transport).TLSClientConfig
+
+	svc := testService("agent", backend.URL)
+	svc.Protocol = config.ProtocolGRPCWeb
+	handler := GRPCWebHandler(svc, newTestBreaker(), cfg, tr)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/agent/echo.Echo/Ping",
+		bytes.NewReader(grpcFrame(0, []byte("ping"))))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+	if !bytes.Contains(rec.Body.Bytes(), []byte("grpc-status: 0")) {
+		t.Fatalf("response missing grpc-status trailer: %q", rec.Body.Bytes())
+	}
+}
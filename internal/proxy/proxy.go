@@ -0,0 +1,612 @@
+// Package proxy implements the reverse-proxy handlers that forward API
+// traffic to the backend services.
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/breaker"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/jsonschema"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/maintenance"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/middleware"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/reqlog"
+)
+
+// contextKey scopes proxy-internal context values.
+type contextKey string
+
+// originalPathKey stores the request path as it arrived at the gateway, so
+// the director computes the upstream path from a stable source no matter how
+// many times it runs.
+const originalPathKey contextKey = "originalPath"
+
+// gatewayStartKey and upstreamStartKey carry the handling and round-trip
+// start times to ModifyResponse, which stamps Server-Timing while response
+// headers are still unwritten.
+const (
+	gatewayStartKey  contextKey = "gatewayStart"
+	upstreamStartKey contextKey = "upstreamStart"
+)
+
+// breakerErrorScanLimit caps how much of a response body the in-band error
+// detector inspects; degraded-state markers sit at the front of the payload.
+const breakerErrorScanLimit = 4096
+
+// errorSniffer tees the first breakerErrorScanLimit bytes of the response
+// body so the handler can match an in-band error marker after the fact.
+type errorSniffer struct {
+	*middleware.ResponseRecorder
+	buf bytes.Buffer
+}
+
+func (s *errorSniffer) Write(b []byte) (int, error) {
+	if remaining := breakerErrorScanLimit - s.buf.Len(); remaining > 0 {
+		if len(b) <= remaining {
+			s.buf.Write(b)
+		} else {
+			s.buf.Write(b[:remaining])
+		}
+	}
+	return s.ResponseRecorder.Write(b)
+}
+
+// matched reports whether the scanned body prefix contains marker.
+func (s *errorSniffer) matched(marker string) bool {
+	return marker != "" && bytes.Contains(s.buf.Bytes(), []byte(marker))
+}
+
+// ProxyHandler returns the handler proxying /api/<service>/* to the
+// service's upstream, guarded by its circuit breaker. rt is the shared
+// upstream transport; nil uses the default.
+func ProxyHandler(svc *config.ServiceConfig, cb *breaker.CircuitBreaker, cfg *config.Config, rt http.RoundTripper) http.HandlerFunc {
+	weighted := svc.Targets
+	if len(weighted) == 0 {
+		weighted = []config.WeightedTarget{{URL: svc.URL, Weight: 1}}
+	}
+
+	prefix := "/api/" + svc.Name
+
+	// Each target gets its own reverse proxy; requests pick one according
+	// to the configured weights (weighted-random canary splitting) or, in
+	// consistent_hash mode, by a stable hash of the caller's identity.
+	var pool []*upstream
+	totalWeight := 0
+	for _, wt := range weighted {
+		target, err := url.Parse(wt.URL)
+		if err != nil {
+			log.Printf("invalid %s service URL %q: %v", svc.Name, wt.URL, err)
+			return func(w http.ResponseWriter, r *http.Request) {
+				writeJSONError(w, http.StatusInternalServerError, "service misconfigured")
+			}
+		}
+		pool = append(pool, &upstream{
+			rp:      newReverseProxy(target, svc, cfg, rt, prefix),
+			rawURL:  wt.URL,
+			version: target.Host,
+			weight:  wt.Weight,
+		})
+		totalWeight += wt.Weight
+	}
+
+	var schema *jsonschema.Schema
+	if svc.RequestSchemaPath != "" {
+		loaded, err := jsonschema.LoadFile(svc.RequestSchemaPath)
+		if err != nil {
+			log.Printf("invalid request schema for %s: %v", svc.Name, err)
+			return func(w http.ResponseWriter, r *http.Request) {
+				writeJSONError(w, http.StatusInternalServerError, "service misconfigured")
+			}
+		}
+		schema = loaded
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		handlingStart := time.Now()
+
+		// Per-service deadline profiles override the server-wide
+		// ReadTimeout/WriteTimeout for just this connection.
+		rc := http.NewResponseController(w)
+		if svc.ReadDeadline > 0 {
+			if err := rc.SetReadDeadline(time.Now().Add(svc.ReadDeadline)); err != nil {
+				reqlog.Printf(r, svc.Name, "setting read deadline: %v", err)
+			}
+		}
+		if svc.WriteDeadline > 0 {
+			if err := rc.SetWriteDeadline(time.Now().Add(svc.WriteDeadline)); err != nil {
+				reqlog.Printf(r, svc.Name, "setting write deadline: %v", err)
+			}
+		}
+
+		// On a CORS-passthrough route the upstream's headers are the only
+		// ones that should reach the client; drop anything the gateway's
+		// CORS middleware already staged on the response.
+		if svc.PassthroughUpstreamCORS {
+			for h := range w.Header() {
+				if strings.HasPrefix(h, "Access-Control-") {
+					w.Header().Del(h)
+				}
+			}
+		}
+
+		// A service in maintenance is answered at the edge: the upstream is
+		// never contacted and the breaker records nothing.
+		if maintenance.Default.Enabled(svc.Name) {
+			message := cfg.MaintenanceMessage
+			if message == "" {
+				message = "service under maintenance"
+			}
+			retryAfter := cfg.MaintenanceRetryAfter
+			if retryAfter <= 0 {
+				retryAfter = time.Minute
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			writeJSONError(w, http.StatusServiceUnavailable, message)
+			return
+		}
+
+		if !svc.AllowsMethod(r.Method) {
+			w.Header().Set("Allow", strings.Join(svc.AllowedMethods, ", "))
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed for this service")
+			return
+		}
+
+		// The per-service body cap wins over the global one; oversized
+		// bodies with a declared length fail fast, chunked ones are cut off
+		// by MaxBytesReader mid-copy and surface through the ErrorHandler.
+		if limit := bodyLimit(svc, cfg); limit > 0 {
+			if r.ContentLength > limit {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, "request body too large")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+
+		// Schema validation covers POST bodies only: reads carry no payload
+		// worth checking, and PUT/PATCH shapes are the backend's contract.
+		if schema != nil && r.Method == http.MethodPost {
+			if ok := validateRequestBody(w, r, schema, cfg.SchemaMaxBodyBytes); !ok {
+				return
+			}
+		}
+
+		// An operator probing recovery can skip an open breaker for a single
+		// request, but only with a valid admin key — the header alone is
+		// ignored. The outcome is still recorded below, so a successful
+		// bypass closes the breaker and a failed one keeps it open.
+		bypass := r.Header.Get("X-Bypass-Circuit-Breaker") != "" && middleware.AdminKeyValid(r, cfg)
+		if bypass {
+			reqlog.Printf(r, svc.Name, "circuit breaker bypass authorized by admin key")
+		} else if err := cb.Allow(); err != nil {
+			reqlog.Printf(r, svc.Name, "circuit breaker open, rejecting request")
+			// Tell clients when the breaker will probe again so they back
+			// off instead of hammering an open circuit.
+			w.Header().Set("Retry-After", strconv.Itoa(int(cb.RetryAfter().Seconds())))
+			writeJSONError(w, http.StatusServiceUnavailable, "service temporarily unavailable")
+			return
+		}
+
+		// The overall budget is a single context spanning every attempt:
+		// per-attempt timeouts derive from it, so their sum can never
+		// exceed it, and an attempt started with no budget left is
+		// cancelled immediately rather than running on a fresh clock.
+		if cfg.RequestTotalTimeout > 0 {
+			totalCtx, totalCancel := context.WithTimeout(r.Context(), cfg.RequestTotalTimeout)
+			defer totalCancel()
+			r = r.WithContext(totalCtx)
+		}
+
+		// The timeout context rides on the request so the reverse proxy's
+		// transport cancels the upstream call when the deadline fires; the
+		// ErrorHandler then maps it to a 504 (if nothing was written yet).
+		timeout := cfg.RequestTimeout
+		if svc.RequestTimeout > 0 {
+			timeout = svc.RequestTimeout
+		}
+		if svc.BreakerProbeTimeout > 0 && cb.State() == breaker.StateHalfOpen {
+			// A half-open probe gets its own, typically shorter, budget so
+			// a slow recovery doesn't pin the half-open state.
+			timeout = svc.BreakerProbeTimeout
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		ctx = context.WithValue(ctx, originalPathKey, r.URL.Path)
+		ctx = context.WithValue(ctx, gatewayStartKey, handlingStart)
+		r = r.WithContext(ctx)
+
+		// A debugging override pins the request to one named pool member,
+		// but only with a valid admin key — like the breaker bypass, the
+		// bare header is ignored. Targets outside the configured pool are
+		// rejected rather than proxied blind.
+		chosen := pool[0]
+		if override := r.Header.Get("X-Upstream-Override"); override != "" && middleware.AdminKeyValid(r, cfg) {
+			chosen = findUpstream(pool, override)
+			if chosen == nil {
+				writeJSONError(w, http.StatusBadRequest, "unknown upstream override")
+				return
+			}
+			reqlog.Printf(r, svc.Name, "upstream override to %s authorized by admin key", override)
+			w.Header().Set("X-Backend-Version", chosen.version)
+		} else if len(pool) > 1 {
+			if svc.LBMode == config.LBModeConsistentHash {
+				chosen = pickConsistent(pool, stickyKey(r, cfg))
+			} else {
+				chosen = pickWeighted(pool, totalWeight)
+			}
+			w.Header().Set("X-Backend-Version", chosen.version)
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), upstreamStartKey, time.Now()))
+		sw := middleware.NewResponseRecorder(w)
+		var sniffer *errorSniffer
+		if svc.BreakerErrorSubstring != "" {
+			sniffer = &errorSniffer{ResponseRecorder: sw}
+			chosen.rp.ServeHTTP(sniffer, r)
+		} else {
+			chosen.rp.ServeHTTP(sw, r)
+		}
+
+		// An upstream that reports degradation in-band (a passing status
+		// carrying the configured error marker) counts as a breaker
+		// failure too.
+		if sniffer != nil && !cfg.IsBreakerFailure(sw.Status()) && sniffer.matched(svc.BreakerErrorSubstring) {
+			cb.RecordFailure()
+			return
+		}
+
+		if cfg.IsBreakerFailure(sw.Status()) {
+			cb.RecordFailure()
+			// Gateway-level errors (connection refused and friends) also
+			// sideline this target briefly so sticky users fail over.
+			if sw.Status() >= http.StatusBadGateway {
+				chosen.markDown()
+			}
+		} else if sw.Written() {
+			cb.RecordSuccess()
+			chosen.markUp()
+		}
+	}
+}
+
+// upstream is one member of a service's target pool.
+type upstream struct {
+	rp      *httputil.ReverseProxy
+	rawURL  string
+	version string
+	weight  int
+
+	// downUntil sidelines a target that just failed at the connection
+	// level, letting consistent-hash users fail over to the next node.
+	downUntil atomic.Int64
+}
+
+// upstreamDownFor is how long a failed target is skipped by the
+// consistent-hash picker before it is tried again.
+const upstreamDownFor = 10 * time.Second
+
+func (u *upstream) markDown() { u.downUntil.Store(time.Now().Add(upstreamDownFor).UnixNano()) }
+func (u *upstream) markUp()   { u.downUntil.Store(0) }
+func (u *upstream) healthy() bool {
+	return time.Now().UnixNano() >= u.downUntil.Load()
+}
+
+// findUpstream resolves an X-Upstream-Override value against the configured
+// pool, matching the target URL as configured or its bare host. Nil means
+// the override names no known instance.
+func findUpstream(pool []*upstream, override string) *upstream {
+	for _, up := range pool {
+		if up.rawURL == override || up.version == override {
+			return up
+		}
+	}
+	return nil
+}
+
+// pickWeighted draws a target at random according to the configured weights.
+func pickWeighted(pool []*upstream, totalWeight int) *upstream {
+	n := rand.Intn(totalWeight)
+	for _, up := range pool {
+		if n < up.weight {
+			return up
+		}
+		n -= up.weight
+	}
+	return pool[0]
+}
+
+// pickConsistent hashes the sticky key to a target so the same user lands on
+// the same node, walking forward past unhealthy targets. When everything is
+// down the hashed choice is used anyway.
+func pickConsistent(pool []*upstream, key string) *upstream {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	start := int(h.Sum32()) % len(pool)
+	if start < 0 {
+		start += len(pool)
+	}
+	for i := 0; i < len(pool); i++ {
+		if up := pool[(start+i)%len(pool)]; up.healthy() {
+			return up
+		}
+	}
+	return pool[start]
+}
+
+// stickyKey resolves the identity the consistent-hash mode sticks on.
+func stickyKey(r *http.Request, cfg *config.Config) string {
+	if id := middleware.GetUserID(r); id != "" {
+		return id
+	}
+	return middleware.ClientIP(r, cfg)
+}
+
+// newReverseProxy builds the reverse proxy for one upstream target, wiring
+// the gateway's director, response rewrites, and error mapping.
+func newReverseProxy(target *url.URL, svc *config.ServiceConfig, cfg *config.Config, rt http.RoundTripper, prefix string) *httputil.ReverseProxy {
+	rp := httputil.NewSingleHostReverseProxy(target)
+	if rt != nil {
+		rp.Transport = rt
+	}
+	rp.Director = directorFor(rp.Director, target, prefix, cfg)
+
+	rp.ModifyResponse = func(resp *http.Response) error {
+		// Some backends gzip unconditionally; unpack for clients that
+		// can't handle it.
+		if cfg.DecompressUpstream && resp.Header.Get("Content-Encoding") == "gzip" &&
+			!strings.Contains(resp.Request.Header.Get("Accept-Encoding"), "gzip") {
+			if err := decompressResponse(resp); err != nil {
+				return err
+			}
+		}
+		// Upstream cookies scoped to an internal domain would be rejected
+		// by browsers talking to the gateway's public domain.
+		if svc.RewriteCookies {
+			rewriteSetCookies(resp, cfg.PublicDomain, prefix)
+		}
+		// Redirects pointing at the internal backend host would leak it
+		// and dead-end the client; re-point them at the gateway.
+		for _, h := range []string{"Location", "Content-Location"} {
+			if v := resp.Header.Get(h); v != "" {
+				resp.Header.Set(h, rewriteLocationURL(v, target, prefix, cfg.PublicDomain))
+			}
+		}
+		for name, value := range cfg.ResponseHeaderRewrite {
+			if value == "" {
+				resp.Header.Del(name)
+			} else {
+				resp.Header.Set(name, value)
+			}
+		}
+		// Strip upstream CORS headers; the gateway is the CORS authority —
+		// unless this route trusts its backend to speak CORS for itself.
+		if !svc.PassthroughUpstreamCORS {
+			for h := range resp.Header {
+				if strings.HasPrefix(h, "Access-Control-") {
+					resp.Header.Del(h)
+				}
+			}
+			if origin := resp.Request.Header.Get("Origin"); origin != "" {
+				if middleware.OriginAllowedStrict(origin, cfg) {
+					resp.Header.Set("Access-Control-Allow-Origin", origin)
+					resp.Header.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+		}
+		// Response headers haven't been written yet, so timing segments can
+		// still be attached: gateway covers handling so far, upstream just
+		// the proxy round trip.
+		ctx := resp.Request.Context()
+		if upstreamStart, ok := ctx.Value(upstreamStartKey).(time.Time); ok {
+			timing := fmt.Sprintf("upstream;dur=%.1f", durMillis(upstreamStart))
+			if gatewayStart, ok := ctx.Value(gatewayStartKey).(time.Time); ok {
+				timing = fmt.Sprintf("gateway;dur=%.1f, %s", durMillis(gatewayStart), timing)
+			}
+			resp.Header.Set("Server-Timing", timing)
+		}
+		return nil
+	}
+
+	rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		// A cancelled request context means the client hung up, not that
+		// the upstream misbehaved: note it and write nothing, so the
+		// breaker records neither a failure nor a success. The deadline
+		// path below stays a real failure (504).
+		if errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			reqlog.Printf(r, svc.Name, "client disconnected before the response completed")
+			return
+		}
+		reqlog.Printf(r, svc.Name, "proxy error: %v", err)
+		// The breaker failure is recorded from the written status below.
+		// The transport has already cancelled the upstream call by the time
+		// we get here; only write if headers haven't gone out.
+		if sw, ok := w.(*middleware.ResponseRecorder); ok && sw.Written() {
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			writeJSONError(w, http.StatusGatewayTimeout, "upstream timeout")
+			return
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		writeJSONError(w, http.StatusBadGateway, "upstream unavailable")
+	}
+	return rp
+}
+
+// directorFor wraps the stdlib single-host director with the gateway's path
+// and header rewrites. It is deliberately idempotent: re-running it on the
+// same request (an internal retry re-dispatching through the proxy) yields
+// the same upstream path and headers.
+func directorFor(originalDirector func(*http.Request), target *url.URL, prefix string, cfg *config.Config) func(*http.Request) {
+	return func(req *http.Request) {
+		originalDirector(req)
+		// Strip the gateway route prefix and graft what's left onto the
+		// target's base path, so targets like http://host/base work. The
+		// inbound path is taken from the context snapshot rather than
+		// req.URL.Path, which the stdlib director has already rewritten —
+		// this keeps the director idempotent if a retry ever re-runs it.
+		orig, _ := req.Context().Value(originalPathKey).(string)
+		if orig == "" {
+			orig = req.URL.Path
+		}
+		stripped := strings.TrimPrefix(orig, prefix)
+		req.URL.Path = SingleJoiningSlash(target.Path, stripped)
+		// Set the request ID from the context explicitly so it reaches the
+		// upstream regardless of middleware ordering.
+		if id := middleware.GetRequestID(req); id != "" {
+			req.Header.Set("X-Request-ID", id)
+		}
+		// The reverse proxy appends the bare peer IP to X-Forwarded-For
+		// itself; we only decide whether the inbound chain survives. Chains
+		// from untrusted sources are spoofable and dropped.
+		realIP := middleware.ClientIP(req, cfg)
+		if !middleware.FromTrustedProxy(req, cfg) {
+			req.Header.Del("X-Forwarded-For")
+		}
+		req.Header.Set("X-Real-IP", realIP)
+		req.Header.Set("X-Forwarded-Host", req.Host)
+		// Tell the backend how much budget remains so it can abandon work
+		// it cannot finish in time. Recomputed from the context deadline,
+		// so a retry re-running the director sends the honest remainder.
+		if deadline, ok := req.Context().Deadline(); ok {
+			if remaining := time.Until(deadline).Milliseconds(); remaining > 0 {
+				req.Header.Set("X-Request-Deadline-MS", strconv.FormatInt(remaining, 10))
+			}
+		}
+		// Forward configured JWT claims to the upstream as headers.
+		if claims := middleware.GetClaims(req); claims != nil {
+			for claim, header := range cfg.ForwardClaims {
+				if v, ok := claims[claim].(string); ok {
+					req.Header.Set(header, v)
+				}
+			}
+		}
+		req.Host = target.Host
+	}
+}
+
+// rewriteLocationURL re-scopes a Location or Content-Location value for the
+// gateway: URLs on the internal backend host move to the gateway's public
+// domain (or become relative when none is configured), and the backend path
+// is grafted back under the service prefix. Relative URLs get the prefix
+// graft only; absolute URLs on foreign hosts pass through untouched.
+func rewriteLocationURL(raw string, target *url.URL, prefix, publicDomain string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	if u.Host != "" && u.Host != target.Host {
+		return raw
+	}
+	if base := strings.TrimSuffix(target.Path, "/"); base != "" {
+		u.Path = strings.TrimPrefix(u.Path, base)
+	}
+	u.Path = SingleJoiningSlash(prefix, u.Path)
+	if u.Host != "" {
+		if publicDomain != "" {
+			u.Host = publicDomain
+		} else {
+			// Without a configured public domain, a relative URL keeps the
+			// client on whatever host it reached the gateway through.
+			u.Scheme, u.Host = "", ""
+		}
+	}
+	return u.String()
+}
+
+// durMillis returns the elapsed time since start in fractional
+// milliseconds, the unit Server-Timing expects.
+func durMillis(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+// rewriteSetCookies re-scopes upstream Set-Cookie headers for the gateway's
+// public domain: Domain is replaced with publicDomain (dropped when none is
+// configured, scoping the cookie to the gateway host) and the cookie Path
+// is grafted under the service prefix. Secure, HttpOnly, SameSite, and
+// expiry attributes survive the rewrite.
+func rewriteSetCookies(resp *http.Response, publicDomain, prefix string) {
+	cookies := resp.Cookies()
+	if len(cookies) == 0 {
+		return
+	}
+	resp.Header.Del("Set-Cookie")
+	for _, c := range cookies {
+		c.Domain = publicDomain
+		switch c.Path {
+		case "", "/":
+			c.Path = prefix
+		default:
+			c.Path = prefix + c.Path
+		}
+		resp.Header.Add("Set-Cookie", c.String())
+	}
+}
+
+// decompressResponse replaces a gzipped response body with its plain form,
+// fixing Content-Length and dropping Content-Encoding. The body is buffered,
+// which is the price of a correct length header.
+func decompressResponse(resp *http.Response) error {
+	gr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(gr)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Del("Content-Encoding")
+	return nil
+}
+
+// bodyLimit resolves the effective request-body cap for a service.
+func bodyLimit(svc *config.ServiceConfig, cfg *config.Config) int64 {
+	if svc.MaxRequestBodyBytes > 0 {
+		return svc.MaxRequestBodyBytes
+	}
+	return cfg.MaxRequestBodyBytes
+}
+
+// SingleJoiningSlash joins two URL path segments with exactly one slash,
+// mirroring the stdlib reverse proxy's joining behavior.
+func SingleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// writeJSONError writes a JSON error envelope with the given status.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,1431 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/breaker"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/maintenance"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/middleware"
+)
+
+func testConfig() *config.Config {
+	return &config.Config{
+		Environment:             "test",
+		RequestTimeout:          5 * time.Second,
+		CircuitBreakerThreshold: 5,
+		CircuitBreakerTimeout:   time.Second,
+		Services:                map[string]*config.ServiceConfig{},
+	}
+}
+
+func newTestBreaker() *breaker.CircuitBreaker {
+	return breaker.New(5, time.Second)
+}
+
+func testService(name, url string) *config.ServiceConfig {
+	return &config.ServiceConfig{Name: name, URL: url}
+}
+
+func TestMethodAllowListBlocksDisallowedVerb(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	svc := &config.ServiceConfig{Name: "rag", URL: backend.URL, AllowedMethods: []string{"GET", "POST"}}
+	handler := ProxyHandler(svc, newTestBreaker(), cfg, nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/rag/documents/1", nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("DELETE: got status %d, want 405", rec.Code)
+	}
+	allow := rec.Header().Get("Allow")
+	if !strings.Contains(allow, "GET") || !strings.Contains(allow, "POST") {
+		t.Fatalf("Allow header = %q, want GET and POST listed", allow)
+	}
+}
+
+func TestMethodAllowListPassesAllowedVerb(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	svc := &config.ServiceConfig{Name: "rag", URL: backend.URL, AllowedMethods: []string{"GET", "POST"}}
+	handler := ProxyHandler(svc, newTestBreaker(), cfg, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/rag/documents/1", nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET: got status %d, want 200", rec.Code)
+	}
+}
+
+func TestRequestTimeoutCancelsUpstream(t *testing.T) {
+	upstreamCancelled := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(upstreamCancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.RequestTimeout = 50 * time.Millisecond
+	handler := ProxyHandler(testService("agent", backend.URL), newTestBreaker(), cfg, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/slow", nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("got status %d, want 504", rec.Code)
+	}
+	select {
+	case <-upstreamCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("upstream request context was not cancelled")
+	}
+}
+
+func TestHalfOpenProbeUsesProbeTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.RequestTimeout = 5 * time.Second
+	svc := testService("agent", backend.URL)
+	svc.BreakerProbeTimeout = 50 * time.Millisecond
+
+	cb := breaker.New(1, 10*time.Millisecond)
+	handler := ProxyHandler(svc, cb, cfg, nil)
+
+	// Trip the breaker, then wait out the cooldown so the next request is
+	// the half-open probe.
+	cb.RecordFailure()
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/agent/ping", nil))
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("probe: got status %d, want 504", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("probe took %v, want it bounded by the 50ms probe timeout", elapsed)
+	}
+}
+
+func TestProxyComposesTargetBasePath(t *testing.T) {
+	var gotPath string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	for _, tc := range []struct {
+		targetSuffix string
+		reqPath      string
+		want         string
+	}{
+		{"/base", "/api/agent/chat", "/base/chat"},
+		{"/base/", "/api/agent/chat", "/base/chat"},
+		{"", "/api/agent/chat", "/chat"},
+		{"/base", "/api/agent/", "/base/"},
+	} {
+		cfg := testConfig()
+		handler := ProxyHandler(testService("agent", backend.URL+tc.targetSuffix), newTestBreaker(), cfg, nil)
+
+		req := httptest.NewRequest(http.MethodGet, tc.reqPath, nil)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("target %q path %q: got status %d", tc.targetSuffix, tc.reqPath, rec.Code)
+		}
+		if gotPath != tc.want {
+			t.Errorf("target %q path %q: upstream saw %q, want %q", tc.targetSuffix, tc.reqPath, gotPath, tc.want)
+		}
+	}
+}
+
+func TestMethodAllowListDefaultsToAllMethods(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	svc := &config.ServiceConfig{Name: "agent", URL: backend.URL}
+	handler := ProxyHandler(svc, newTestBreaker(), cfg, nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/agent/tasks/1", nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("DELETE with no allow-list: got status %d, want 200", rec.Code)
+	}
+}
+
+func TestTinyTimeoutStillServesGraceful504s(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.RequestTimeout = time.Millisecond
+	cb := breaker.New(1000, time.Second)
+	handler := ProxyHandler(testService("agent", backend.URL), cb, cfg, nil)
+
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Fatalf("request %d: got status %d, want 504", i, rec.Code)
+		}
+	}
+	if cb.State() != breaker.StateClosed {
+		t.Fatalf("breaker state = %v, want closed below threshold", cb.State())
+	}
+}
+
+func TestForwardedForChaining(t *testing.T) {
+	var gotXFF, gotRealIP string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotXFF = r.Header.Get("X-Forwarded-For")
+		gotRealIP = r.Header.Get("X-Real-IP")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	_, lbNet, _ := net.ParseCIDR("10.0.0.0/8")
+
+	for _, tc := range []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		trusted    []*net.IPNet
+		wantXFF    string
+		wantRealIP string
+	}{
+		{
+			name:       "direct connection",
+			remoteAddr: "1.2.3.4:5678",
+			wantXFF:    "1.2.3.4",
+			wantRealIP: "1.2.3.4",
+		},
+		{
+			name:       "chain via trusted proxy",
+			remoteAddr: "10.0.0.7:4321",
+			xff:        "1.2.3.4",
+			trusted:    []*net.IPNet{lbNet},
+			wantXFF:    "1.2.3.4, 10.0.0.7",
+			wantRealIP: "1.2.3.4",
+		},
+		{
+			name:       "spoofed header from untrusted source",
+			remoteAddr: "9.9.9.9:1111",
+			xff:        "1.2.3.4",
+			wantXFF:    "9.9.9.9",
+			wantRealIP: "9.9.9.9",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.TrustedProxies = tc.trusted
+			handler := ProxyHandler(testService("agent", backend.URL), newTestBreaker(), cfg, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/agent/x", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.xff != "" {
+				req.Header.Set("X-Forwarded-For", tc.xff)
+			}
+			handler(httptest.NewRecorder(), req)
+
+			if gotXFF != tc.wantXFF {
+				t.Errorf("X-Forwarded-For = %q, want %q", gotXFF, tc.wantXFF)
+			}
+			if gotRealIP != tc.wantRealIP {
+				t.Errorf("X-Real-IP = %q, want %q", gotRealIP, tc.wantRealIP)
+			}
+		})
+	}
+}
+
+func TestDirectorIsIdempotent(t *testing.T) {
+	target, _ := url.Parse("http://backend:8001/base")
+	rp := httputil.NewSingleHostReverseProxy(target)
+	director := directorFor(rp.Director, target, "/api/agent", testConfig())
+
+	req := httptest.NewRequest(http.MethodGet, "http://gateway/api/agent/run/5", nil)
+	req = req.WithContext(context.WithValue(req.Context(), originalPathKey, req.URL.Path))
+
+	director(req)
+	want := req.URL.Path
+	if want != "/base/run/5" {
+		t.Fatalf("first invocation: path = %q, want /base/run/5", want)
+	}
+
+	// A re-dispatch running the director again must not strip or graft the
+	// prefix a second time.
+	director(req)
+	if req.URL.Path != want {
+		t.Fatalf("second invocation: path = %q, want %q", req.URL.Path, want)
+	}
+}
+
+func TestForwardClaimsReachBackend(t *testing.T) {
+	var gotEmail, gotTenant string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEmail = r.Header.Get("X-User-Email")
+		gotTenant = r.Header.Get("X-Tenant-ID")
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.SupabaseJWTSecret = "test-secret"
+	cfg.ForwardClaims = map[string]string{
+		"email":     "X-User-Email",
+		"tenant_id": "X-Tenant-ID",
+	}
+
+	handler := middleware.AuthMiddleware(cfg)(
+		ProxyHandler(testService("agent", backend.URL), newTestBreaker(), cfg, nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/run", nil)
+	req.Header.Set("Authorization", "Bearer "+signProxyTestJWT(t, "test-secret", map[string]interface{}{
+		"sub":       "user-1",
+		"email":     "dev@example.com",
+		"tenant_id": "tenantA",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if gotEmail != "dev@example.com" {
+		t.Errorf("X-User-Email = %q, want dev@example.com", gotEmail)
+	}
+	if gotTenant != "tenantA" {
+		t.Errorf("X-Tenant-ID = %q, want tenantA", gotTenant)
+	}
+}
+
+// signProxyTestJWT builds an HS256 token for exercising claim forwarding.
+func signProxyTestJWT(t *testing.T, secret string, claims map[string]interface{}) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	body := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestPerServiceBodyLimitOverridesGlobal(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.MaxRequestBodyBytes = 16
+
+	// rag raises the cap; llm inherits the global 16 bytes.
+	rag := testService("rag", backend.URL)
+	rag.MaxRequestBodyBytes = 1024
+	llm := testService("llm", backend.URL)
+
+	body := strings.Repeat("x", 100)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/rag/upload", strings.NewReader(body))
+	ProxyHandler(rag, newTestBreaker(), cfg, nil)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("rag under its raised limit: got status %d, want 200", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/api/llm/generate", strings.NewReader(body))
+	ProxyHandler(llm, newTestBreaker(), cfg, nil)(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("llm over the global limit: got status %d, want 413", rec.Code)
+	}
+}
+
+// gzipBackend always gzips its response, regardless of Accept-Encoding.
+func gzipBackend(t *testing.T, payload string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Type", "application/json")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(payload))
+		gz.Close()
+	}))
+}
+
+func TestDecompressUpstreamForNonGzipClients(t *testing.T) {
+	const payload = `{"answer":42}`
+	backend := gzipBackend(t, payload)
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.DecompressUpstream = true
+	handler := ProxyHandler(testService("llm", backend.URL), newTestBreaker(), cfg, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil)
+	req.Header.Set("Accept-Encoding", "identity")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want removed", got)
+	}
+	if rec.Body.String() != payload {
+		t.Errorf("body = %q, want decompressed %q", rec.Body.String(), payload)
+	}
+	if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(len(payload)) {
+		t.Errorf("Content-Length = %q, want %d", got, len(payload))
+	}
+}
+
+func TestDecompressUpstreamPassesThroughForGzipClients(t *testing.T) {
+	const payload = `{"answer":42}`
+	backend := gzipBackend(t, payload)
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.DecompressUpstream = true
+	handler := ProxyHandler(testService("llm", backend.URL), newTestBreaker(), cfg, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip pass-through", got)
+	}
+	gr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	decoded, _ := io.ReadAll(gr)
+	if string(decoded) != payload {
+		t.Errorf("decoded body = %q, want %q", decoded, payload)
+	}
+}
+
+func TestWeightedCanarySplit(t *testing.T) {
+	hits := map[string]int{}
+	var mu sync.Mutex
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits[name]++
+			mu.Unlock()
+		}))
+	}
+	v1 := newBackend("v1")
+	defer v1.Close()
+	v2 := newBackend("v2")
+	defer v2.Close()
+
+	svc := testService("llm", v1.URL)
+	svc.Targets = []config.WeightedTarget{
+		{URL: v1.URL, Weight: 90},
+		{URL: v2.URL, Weight: 10},
+	}
+	handler := ProxyHandler(svc, newTestBreaker(), testConfig(), nil)
+
+	const total = 1000
+	versions := map[string]int{}
+	for i := 0; i < total; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/llm/generate", nil))
+		versions[rec.Header().Get("X-Backend-Version")]++
+	}
+
+	if hits["v1"]+hits["v2"] != total {
+		t.Fatalf("backends saw %d requests, want %d", hits["v1"]+hits["v2"], total)
+	}
+	// 10% ±5 points is plenty of slack for 1000 weighted-random draws.
+	canaryShare := float64(hits["v2"]) / total
+	if canaryShare < 0.05 || canaryShare > 0.15 {
+		t.Errorf("canary share = %.3f, want roughly 0.10", canaryShare)
+	}
+	// Every response is labeled with the serving backend's host.
+	for version, count := range versions {
+		if version == "" {
+			t.Errorf("%d responses missing X-Backend-Version", count)
+		}
+	}
+}
+
+func TestPerServiceWriteDeadlineAllowsLongStreams(t *testing.T) {
+	// The backend streams events for well past the server's WriteTimeout.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		f := w.(http.Flusher)
+		for i := 0; i < 6; i++ {
+			fmt.Fprintf(w, "data: chunk-%d\n\n", i)
+			f.Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer backend.Close()
+
+	svc := testService("llm", backend.URL)
+	svc.WriteDeadline = 10 * time.Second
+
+	gateway := httptest.NewUnstartedServer(ProxyHandler(svc, newTestBreaker(), testConfig(), nil))
+	gateway.Config.WriteTimeout = 200 * time.Millisecond
+	gateway.Start()
+	defer gateway.Close()
+
+	resp, err := http.Get(gateway.URL + "/api/llm/stream")
+	if err != nil {
+		t.Fatalf("stream request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("stream was cut by the server deadline: %v", err)
+	}
+	if !strings.Contains(string(body), "chunk-5") {
+		t.Errorf("stream incomplete, got %q", body)
+	}
+}
+
+func TestConsistentHashSticksPerUser(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	a := newBackend("a")
+	defer a.Close()
+	b := newBackend("b")
+	defer b.Close()
+
+	svc := testService("agent", a.URL)
+	svc.LBMode = config.LBModeConsistentHash
+	svc.Targets = []config.WeightedTarget{{URL: a.URL, Weight: 1}, {URL: b.URL, Weight: 1}}
+	cfg := testConfig()
+	handler := middleware.AuthMiddleware(cfg)(ProxyHandler(svc, newTestBreaker(), cfg, nil))
+
+	serve := func(user string) string {
+		req := httptest.NewRequest(http.MethodGet, "/api/agent/run", nil)
+		req.Header.Set("X-User-ID", user)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	// Each user lands on one node, consistently.
+	users := []string{"alice", "bob", "carol", "dave", "erin"}
+	landed := map[string]bool{}
+	for _, user := range users {
+		first := serve(user)
+		landed[first] = true
+		for i := 0; i < 10; i++ {
+			if got := serve(user); got != first {
+				t.Fatalf("user %s moved from %q to %q", user, first, got)
+			}
+		}
+	}
+	if len(landed) < 2 {
+		t.Errorf("all users hashed to one node; want load spread across the pool")
+	}
+}
+
+func TestConsistentHashFailsOverWhenNodeDrops(t *testing.T) {
+	a := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("a"))
+	}))
+	defer a.Close()
+	b := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("b"))
+	}))
+
+	svc := testService("agent", a.URL)
+	svc.LBMode = config.LBModeConsistentHash
+	svc.Targets = []config.WeightedTarget{{URL: a.URL, Weight: 1}, {URL: b.URL, Weight: 1}}
+	cfg := testConfig()
+	handler := middleware.AuthMiddleware(cfg)(ProxyHandler(svc, newTestBreaker(), cfg, nil))
+
+	// Find a user pinned to node b, then drop b.
+	var pinned string
+	for _, user := range []string{"alice", "bob", "carol", "dave", "erin", "frank"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/agent/run", nil)
+		req.Header.Set("X-User-ID", user)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Body.String() == "b" {
+			pinned = user
+			break
+		}
+	}
+	if pinned == "" {
+		t.Fatal("no user hashed to node b")
+	}
+	b.Close()
+
+	// The first request after the drop fails and sidelines b; the next one
+	// lands on a.
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/agent/run", nil)
+		req.Header.Set("X-User-ID", pinned)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Body.String() == "a" {
+			return
+		}
+	}
+	t.Error("user was not rebalanced to the surviving node")
+}
+
+func TestServerTimingHeader(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer backend.Close()
+
+	handler := ProxyHandler(testService("agent", backend.URL), newTestBreaker(), testConfig(), nil)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/agent/run", nil))
+
+	timing := rec.Header().Get("Server-Timing")
+	if timing == "" {
+		t.Fatal("Server-Timing header missing")
+	}
+	durs := map[string]float64{}
+	for _, segment := range strings.Split(timing, ",") {
+		name, dur, ok := strings.Cut(strings.TrimSpace(segment), ";dur=")
+		if !ok {
+			t.Fatalf("malformed Server-Timing segment %q", segment)
+		}
+		v, err := strconv.ParseFloat(dur, 64)
+		if err != nil {
+			t.Fatalf("non-numeric duration in %q", segment)
+		}
+		durs[name] = v
+	}
+	if durs["upstream"] < 40 {
+		t.Errorf("upstream;dur = %.1f, want at least the backend's ~50ms", durs["upstream"])
+	}
+	if durs["gateway"] < durs["upstream"] {
+		t.Errorf("gateway;dur %.1f < upstream;dur %.1f", durs["gateway"], durs["upstream"])
+	}
+}
+
+func TestProductionDoesNotReflectArbitraryOrigins(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.Environment = "production"
+	// No CORS_ORIGINS configured: in dev that means allow-all, in
+	// production it must mean allow none.
+	handler := ProxyHandler(testService("agent", backend.URL), newTestBreaker(), cfg, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/run", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("production reflected origin %q with an empty allow-list", got)
+	}
+
+	// Dev keeps the permissive behavior.
+	cfg = testConfig()
+	handler = ProxyHandler(testService("agent", backend.URL), newTestBreaker(), cfg, nil)
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/agent/run", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	handler(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "http://localhost:3000" {
+		t.Errorf("dev with empty allow-list: Access-Control-Allow-Origin = %q, want reflected origin", got)
+	}
+}
+
+func TestBodyErrorSubstringOpensBreaker(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"error":"overloaded"}`))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	svc := &config.ServiceConfig{Name: "llm", URL: backend.URL, BreakerErrorSubstring: `"error":"overloaded"`}
+	cb := breaker.New(3, time.Minute)
+	handler := ProxyHandler(svc, cb, cfg, nil)
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/llm/status", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want 200 passed through", i, rec.Code)
+		}
+	}
+
+	if got := cb.State(); got != breaker.StateOpen {
+		t.Fatalf("breaker state = %v after repeated in-band errors, want open", got)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/llm/status", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("open breaker: got status %d, want 503", rec.Code)
+	}
+}
+
+func TestBodyErrorSubstringIgnoresHealthyBodies(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result":"fine"}`))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	svc := &config.ServiceConfig{Name: "llm", URL: backend.URL, BreakerErrorSubstring: "overloaded"}
+	cb := breaker.New(1, time.Minute)
+	handler := ProxyHandler(svc, cb, cfg, nil)
+
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/llm/status", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want 200", i, rec.Code)
+		}
+	}
+	if got := cb.State(); got != breaker.StateClosed {
+		t.Fatalf("breaker state = %v for healthy bodies, want closed", got)
+	}
+}
+
+func TestStatusWriterCountsProxiedBytes(t *testing.T) {
+	payload := strings.Repeat("z", 512)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(payload))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	handler := ProxyHandler(testService("agent", backend.URL), newTestBreaker(), cfg, nil)
+
+	rec := httptest.NewRecorder()
+	sw := middleware.NewResponseRecorder(rec)
+	handler(sw, httptest.NewRequest(http.MethodGet, "/api/agent/data", nil))
+
+	if got := rec.Body.Len(); got != len(payload) {
+		t.Fatalf("body length = %d, want %d", got, len(payload))
+	}
+}
+
+func TestStatusWriterByteCount(t *testing.T) {
+	sw := middleware.NewResponseRecorder(httptest.NewRecorder())
+	sw.Write([]byte("hello, "))
+	sw.Write([]byte("world"))
+	if got := sw.BytesWritten(); got != int64(len("hello, world")) {
+		t.Fatalf("BytesWritten = %d, want %d", got, len("hello, world"))
+	}
+	if sw.Status() != http.StatusOK {
+		t.Errorf("status = %d, want implicit 200", sw.Status())
+	}
+}
+
+func TestBreakerBypassWithAdminKey(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("recovered"))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.AdminAPIKey = "secret-admin-key"
+	cb := breaker.New(1, time.Hour)
+	cb.RecordFailure() // trip it; the hour-long cooldown keeps it open
+	handler := ProxyHandler(testService("agent", backend.URL), cb, cfg, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/ping", nil)
+	req.Header.Set("X-Bypass-Circuit-Breaker", "1")
+	req.Header.Set("X-Admin-Key", "secret-admin-key")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bypass with admin key: got %d, want 200", rec.Code)
+	}
+	// The successful bypass's outcome informs the breaker.
+	if got := cb.State(); got != breaker.StateClosed {
+		t.Errorf("breaker state after successful bypass = %v, want closed", got)
+	}
+}
+
+func TestBreakerBypassIgnoredWithoutAdminKey(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.AdminAPIKey = "secret-admin-key"
+	cb := breaker.New(1, time.Hour)
+	cb.RecordFailure()
+	handler := ProxyHandler(testService("agent", backend.URL), cb, cfg, nil)
+
+	for _, wrongKey := range []string{"", "wrong-key"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/agent/ping", nil)
+		req.Header.Set("X-Bypass-Circuit-Breaker", "1")
+		if wrongKey != "" {
+			req.Header.Set("X-Admin-Key", wrongKey)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("admin key %q: got %d, want 503 (bypass ignored)", wrongKey, rec.Code)
+		}
+	}
+}
+
+func TestBreakerBypassNeverValidWithUnsetAdminKey(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	cfg := testConfig() // no AdminAPIKey configured
+	cb := breaker.New(1, time.Hour)
+	cb.RecordFailure()
+	handler := ProxyHandler(testService("agent", backend.URL), cb, cfg, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/ping", nil)
+	req.Header.Set("X-Bypass-Circuit-Breaker", "1")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want 503: bypass must not work without a configured admin key", rec.Code)
+	}
+}
+
+func TestUpstreamCookieRewrittenToGatewayDomain(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     "session",
+			Value:    "abc123",
+			Domain:   "agent.internal.svc",
+			Path:     "/",
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.PublicDomain = "api.example.com"
+	svc := &config.ServiceConfig{Name: "agent", URL: backend.URL, RewriteCookies: true}
+	handler := ProxyHandler(svc, newTestBreaker(), cfg, nil)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/agent/login", nil))
+
+	cookies := (&http.Response{Header: rec.Header()}).Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+	c := cookies[0]
+	if c.Domain != "api.example.com" {
+		t.Errorf("Domain = %q, want api.example.com", c.Domain)
+	}
+	if c.Path != "/api/agent" {
+		t.Errorf("Path = %q, want /api/agent", c.Path)
+	}
+	if !c.Secure || !c.HttpOnly || c.SameSite != http.SameSiteStrictMode {
+		t.Errorf("attributes lost in rewrite: %+v", c)
+	}
+	if c.Value != "abc123" {
+		t.Errorf("Value = %q, want abc123", c.Value)
+	}
+}
+
+func TestUpstreamCookiePassedThroughByDefault(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Domain: "agent.internal.svc"})
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	handler := ProxyHandler(testService("agent", backend.URL), newTestBreaker(), cfg, nil)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/agent/login", nil))
+
+	cookies := (&http.Response{Header: rec.Header()}).Cookies()
+	if len(cookies) != 1 || cookies[0].Domain != "agent.internal.svc" {
+		t.Fatalf("cookie rewritten without opt-in: %+v", cookies)
+	}
+}
+
+func TestConfiguredFailureCodesTripBreakerOn429(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.BreakerFailureCodes = []config.StatusRange{{Lo: 500, Hi: 599}, {Lo: 429, Hi: 429}}
+	cb := breaker.New(3, time.Minute)
+	handler := ProxyHandler(testService("llm", backend.URL), cb, cfg, nil)
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/llm/chat", nil))
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("request %d: got status %d, want 429 passed through", i, rec.Code)
+		}
+	}
+	if got := cb.State(); got != breaker.StateOpen {
+		t.Fatalf("breaker state = %v after repeated 429s, want open", got)
+	}
+}
+
+func TestDefaultFailureCodesIgnore429(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cb := breaker.New(1, time.Minute)
+	handler := ProxyHandler(testService("llm", backend.URL), cb, cfg, nil)
+
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/llm/chat", nil))
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("request %d: got status %d, want 429", i, rec.Code)
+		}
+	}
+	if got := cb.State(); got != breaker.StateClosed {
+		t.Fatalf("breaker state = %v under default failure codes, want closed", got)
+	}
+}
+
+func TestClientCancelIsNotABreakerFailure(t *testing.T) {
+	inBackend := make(chan struct{}, 2)
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inBackend <- struct{}{}
+		<-release
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	cfg := testConfig()
+	cb := breaker.New(1, time.Minute)
+	handler := ProxyHandler(testService("agent", backend.URL), cb, cfg, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/chat", nil).WithContext(ctx)
+	done := make(chan struct{})
+	rec := httptest.NewRecorder()
+	go func() {
+		handler(rec, req)
+		close(done)
+	}()
+
+	<-inBackend
+	cancel()
+	<-done
+
+	if got := cb.Failures(); got != 0 {
+		t.Fatalf("breaker failures = %d after client cancel, want 0", got)
+	}
+	if got := cb.State(); got != breaker.StateClosed {
+		t.Fatalf("breaker state = %v after client cancel, want closed", got)
+	}
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("cancelled request wrote status %d body %q, want nothing written", rec.Code, rec.Body.String())
+	}
+
+	// An upstream deadline is still a failure and still maps to 504.
+	cfg.RequestTimeout = 20 * time.Millisecond
+	handler = ProxyHandler(testService("agent", backend.URL), cb, cfg, nil)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/agent/chat", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("deadline exceeded: got status %d, want 504", rec.Code)
+	}
+	if got := cb.Failures(); got == 0 {
+		t.Error("deadline exceeded should still count as a breaker failure")
+	}
+}
+
+func TestPerServiceRequestTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(80 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.RequestTimeout = 30 * time.Millisecond
+
+	// The agent keeps the short global budget and times out.
+	handler := ProxyHandler(testService("agent", backend.URL), newTestBreaker(), cfg, nil)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/agent/chat", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("agent at global timeout: got status %d, want 504", rec.Code)
+	}
+
+	// The llm override outlasts the backend's delay.
+	llm := testService("llm", backend.URL)
+	llm.RequestTimeout = time.Second
+	handler = ProxyHandler(llm, newTestBreaker(), cfg, nil)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/llm/chat", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("llm with per-service timeout: got status %d, want 200", rec.Code)
+	}
+
+	if got := cfg.MaxRequestTimeout(); got != cfg.RequestTimeout {
+		t.Errorf("MaxRequestTimeout = %v with no overrides in cfg.Services, want %v", got, cfg.RequestTimeout)
+	}
+	cfg.Services = map[string]*config.ServiceConfig{"llm": llm}
+	if got := cfg.MaxRequestTimeout(); got != time.Second {
+		t.Errorf("MaxRequestTimeout = %v, want the llm override %v", got, time.Second)
+	}
+}
+
+func TestDeadlineHeaderReachesUpstream(t *testing.T) {
+	got := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Get("X-Request-Deadline-MS")
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.RequestTimeout = 2 * time.Second
+	handler := ProxyHandler(testService("agent", backend.URL), newTestBreaker(), cfg, nil)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/agent/chat", nil))
+
+	raw := <-got
+	if raw == "" {
+		t.Fatal("X-Request-Deadline-MS header missing on upstream request")
+	}
+	ms, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		t.Fatalf("X-Request-Deadline-MS = %q, want an integer: %v", raw, err)
+	}
+	if ms <= 1000 || ms > 2000 {
+		t.Errorf("X-Request-Deadline-MS = %d, want roughly the 2000ms budget", ms)
+	}
+}
+
+func TestOpenBreakerSetsRetryAfter(t *testing.T) {
+	cfg := testConfig()
+	cb := breaker.New(1, 30*time.Second)
+	cb.RecordFailure()
+	handler := ProxyHandler(testService("agent", "http://localhost:1"), cb, cfg, nil)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/agent/chat", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("open breaker: got status %d, want 503", rec.Code)
+	}
+	secs, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	if err != nil {
+		t.Fatalf("Retry-After = %q, want seconds: %v", rec.Header().Get("Retry-After"), err)
+	}
+	if secs < 28 || secs > 30 {
+		t.Errorf("Retry-After = %ds, want roughly the 30s cooldown", secs)
+	}
+}
+
+func TestLocationRewrittenToPublicHost(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "http://"+r.Host+"/docs/42")
+		w.WriteHeader(http.StatusFound)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.PublicDomain = "api.example.com"
+	handler := ProxyHandler(testService("rag", backend.URL), newTestBreaker(), cfg, nil)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/rag/docs", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("got status %d, want 302", rec.Code)
+	}
+	want := "http://api.example.com/api/rag/docs/42"
+	if got := rec.Header().Get("Location"); got != want {
+		t.Fatalf("Location = %q, want %q", got, want)
+	}
+}
+
+func TestLocationRewriteRelativeAndForeign(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/relative":
+			w.Header().Set("Location", "/docs/7")
+		default:
+			w.Header().Set("Location", "https://elsewhere.example.net/x")
+		}
+		w.WriteHeader(http.StatusFound)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	handler := ProxyHandler(testService("rag", backend.URL), newTestBreaker(), cfg, nil)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/rag/relative", nil))
+	if got := rec.Header().Get("Location"); got != "/api/rag/docs/7" {
+		t.Errorf("relative Location = %q, want /api/rag/docs/7", got)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/rag/foreign", nil))
+	if got := rec.Header().Get("Location"); got != "https://elsewhere.example.net/x" {
+		t.Errorf("foreign Location = %q, want it untouched", got)
+	}
+}
+
+func TestResponseHeaderRewriteMap(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "internal-thing/1.2")
+		w.Header().Set("X-Internal-Debug", "trace-9")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.ResponseHeaderRewrite = map[string]string{"Server": "xynenyx", "X-Internal-Debug": ""}
+	handler := ProxyHandler(testService("agent", backend.URL), newTestBreaker(), cfg, nil)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+	if got := rec.Header().Get("Server"); got != "xynenyx" {
+		t.Errorf("Server = %q, want the rewritten value", got)
+	}
+	if got := rec.Header().Get("X-Internal-Debug"); got != "" {
+		t.Errorf("X-Internal-Debug = %q, want it deleted", got)
+	}
+}
+
+func TestUpstreamCORSPassthrough(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "https://app.partner.example")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Doc-Count")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+
+	// Default: the gateway is the CORS authority and strips upstream headers.
+	handler := ProxyHandler(testService("rag", backend.URL), newTestBreaker(), cfg, nil)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/rag/query", nil))
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "" {
+		t.Errorf("default mode kept upstream Access-Control-Expose-Headers = %q, want stripped", got)
+	}
+
+	// Passthrough: upstream headers survive and staged gateway headers go.
+	svc := testService("rag", backend.URL)
+	svc.PassthroughUpstreamCORS = true
+	handler = ProxyHandler(svc, newTestBreaker(), cfg, nil)
+	rec = httptest.NewRecorder()
+	rec.Header().Set("Access-Control-Allow-Origin", "http://gateway-injected.example")
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/rag/query", nil))
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.partner.example" {
+		t.Errorf("passthrough Access-Control-Allow-Origin = %q, want the upstream's value", got)
+	}
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "X-Doc-Count" {
+		t.Errorf("passthrough Access-Control-Expose-Headers = %q, want X-Doc-Count", got)
+	}
+}
+
+func TestTotalTimeoutCapsSlowRequests(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.RequestTotalTimeout = 50 * time.Millisecond
+	// The per-service budget is far more generous; the total budget must
+	// still win because the attempt context derives from it.
+	svc := testService("llm", backend.URL)
+	svc.RequestTimeout = 5 * time.Second
+	handler := ProxyHandler(svc, newTestBreaker(), cfg, nil)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/llm/chat", nil))
+	elapsed := time.Since(start)
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("got status %d, want 504", rec.Code)
+	}
+	if elapsed > time.Second {
+		t.Fatalf("request took %v, want it bounded by the %v total budget", elapsed, cfg.RequestTotalTimeout)
+	}
+}
+
+func TestProxyLogLinesCarryRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	cfg := testConfig()
+	cb := breaker.New(1, time.Minute)
+	cb.RecordFailure()
+	handler := ProxyHandler(testService("agent", "http://localhost:1"), cb, cfg, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/chat", nil)
+	req = req.WithContext(middleware.WithRequestID(req.Context(), "req-42"))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want 503", rec.Code)
+	}
+	if !strings.Contains(buf.String(), "request_id=req-42 service=agent circuit breaker open") {
+		t.Errorf("breaker log line %q missing request correlation fields", buf.String())
+	}
+}
+
+func TestMaintenanceModeReturns503ThenRecovers(t *testing.T) {
+	backendHits := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendHits++
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.MaintenanceMessage = "llm is being redeployed"
+	cfg.MaintenanceRetryAfter = 30 * time.Second
+	handler := ProxyHandler(testService("llm", backend.URL), newTestBreaker(), cfg, nil)
+
+	maintenance.Default.Set("llm", true)
+	defer maintenance.Default.Set("llm", false)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/llm/complete", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("maintenance on: got %d, want 503", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if body["error"] != "llm is being redeployed" {
+		t.Errorf("error = %q, want the configured message", body["error"])
+	}
+	if backendHits != 0 {
+		t.Fatalf("backend was contacted %d times during maintenance", backendHits)
+	}
+
+	maintenance.Default.Set("llm", false)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/llm/complete", nil))
+	if rec.Code != http.StatusOK || backendHits != 1 {
+		t.Fatalf("after maintenance: got status %d with %d backend hits, want 200 and 1", rec.Code, backendHits)
+	}
+}
+
+func TestUpstreamOverrideHitsNamedInstance(t *testing.T) {
+	hits := map[string]int{}
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[name]++
+			w.Write([]byte(name))
+		}))
+	}
+	a, b := newBackend("a"), newBackend("b")
+	defer a.Close()
+	defer b.Close()
+
+	cfg := testConfig()
+	cfg.AdminAPIKey = "override-admin"
+	svc := testService("agent", a.URL)
+	// All the weight on a, so only the override can reach b.
+	svc.Targets = []config.WeightedTarget{
+		{URL: a.URL, Weight: 1},
+		{URL: b.URL, Weight: 0},
+	}
+	handler := ProxyHandler(svc, newTestBreaker(), cfg, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agent/chat", nil)
+	req.Header.Set("X-Admin-Key", "override-admin")
+	req.Header.Set("X-Upstream-Override", b.URL)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK || hits["b"] != 1 {
+		t.Fatalf("override: status %d, b hits %d; want 200 and 1", rec.Code, hits["b"])
+	}
+
+	// An override naming an instance outside the pool is refused outright.
+	req = httptest.NewRequest(http.MethodGet, "/api/agent/chat", nil)
+	req.Header.Set("X-Admin-Key", "override-admin")
+	req.Header.Set("X-Upstream-Override", "http://rogue:9999")
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown override: got %d, want 400", rec.Code)
+	}
+
+	// Without the admin key the header is ignored and normal selection
+	// (all weight on a) applies.
+	req = httptest.NewRequest(http.MethodGet, "/api/agent/chat", nil)
+	req.Header.Set("X-Upstream-Override", b.URL)
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK || hits["a"] != 1 || hits["b"] != 1 {
+		t.Fatalf("unauthorized override: status %d, hits %v; want 200 served by a", rec.Code, hits)
+	}
+}
+
+// TestExpectContinueUpload pushes a large upload behind Expect: 100-continue
+// through the full server stack; the shared transport's
+// ExpectContinueTimeout lets it run the handshake against the upstream.
+func TestExpectContinueUpload(t *testing.T) {
+	const uploadSize = 256 << 10
+	var gotBytes int
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("backend read: %v", err)
+		}
+		gotBytes = len(body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	handler := ProxyHandler(testService("agent", backend.URL), newTestBreaker(), cfg, nil)
+	gw := httptest.NewServer(handler)
+	defer gw.Close()
+
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 2 * time.Second}}
+	req, _ := http.NewRequest(http.MethodPost, gw.URL+"/api/agent/upload",
+		bytes.NewReader(bytes.Repeat([]byte("x"), uploadSize)))
+	req.Header.Set("Expect", "100-continue")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("got status %d, want 201", resp.StatusCode)
+	}
+	if gotBytes != uploadSize {
+		t.Fatalf("backend received %d bytes, want %d", gotBytes, uploadSize)
+	}
+}
+
+// TestInformationalResponsePassthrough checks that a 103 Early Hints from
+// the upstream reaches the client without becoming the recorded final
+// status (which would confuse the breaker bookkeeping).
+func TestInformationalResponsePassthrough(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("final"))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cb := newTestBreaker()
+	handler := ProxyHandler(testService("agent", backend.URL), cb, cfg, nil)
+	gw := httptest.NewServer(handler)
+	defer gw.Close()
+
+	var got1xx []int
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			got1xx = append(got1xx, code)
+			return nil
+		},
+	}
+	req, _ := http.NewRequest(http.MethodGet, gw.URL+"/api/agent/page", nil)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != "final" {
+		t.Fatalf("final response: status %d body %q", resp.StatusCode, body)
+	}
+	found := false
+	for _, code := range got1xx {
+		if code == http.StatusEarlyHints {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("client saw 1xx codes %v, want a 103", got1xx)
+	}
+	if got := cb.Failures(); got != 0 {
+		t.Fatalf("breaker recorded %d failures for a successful exchange", got)
+	}
+}
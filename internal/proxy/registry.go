@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/breaker"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// registryEntry bundles everything a request needs to be proxied, so a
+// single read yields a consistent snapshot.
+type registryEntry struct {
+	svc     *config.ServiceConfig
+	cb      *breaker.CircuitBreaker
+	handler http.HandlerFunc
+}
+
+// Registry routes /api/<service>/ requests to dynamically registered
+// services. Requests resolve the service under a read lock into a local
+// snapshot, so an Unregister racing with an in-flight request can never
+// leave it pointed at a half-removed service.
+type Registry struct {
+	mu      sync.RWMutex
+	cfg     *config.Config
+	rt      http.RoundTripper
+	entries map[string]*registryEntry
+}
+
+// NewRegistry returns an empty registry building handlers with the given
+// shared config and transport.
+func NewRegistry(cfg *config.Config, rt http.RoundTripper) *Registry {
+	return &Registry{
+		cfg:     cfg,
+		rt:      rt,
+		entries: make(map[string]*registryEntry),
+	}
+}
+
+// Register adds (or replaces) a service and its breaker, picking the
+// handler the service's protocol calls for.
+func (g *Registry) Register(svc *config.ServiceConfig, cb *breaker.CircuitBreaker) {
+	handler := ProxyHandler(svc, cb, g.cfg, g.rt)
+	if svc.Protocol == config.ProtocolGRPCWeb {
+		handler = GRPCWebHandler(svc, cb, g.cfg, g.rt)
+	}
+	entry := &registryEntry{
+		svc:     svc,
+		cb:      cb,
+		handler: handler,
+	}
+	g.mu.Lock()
+	g.entries[svc.Name] = entry
+	g.mu.Unlock()
+}
+
+// Unregister removes a service. In-flight requests holding a snapshot
+// complete against the old target.
+func (g *Registry) Unregister(name string) {
+	g.mu.Lock()
+	delete(g.entries, name)
+	g.mu.Unlock()
+}
+
+// Breaker returns the registered breaker for a service, or nil.
+func (g *Registry) Breaker(name string) *breaker.CircuitBreaker {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if entry, ok := g.entries[name]; ok {
+		return entry.cb
+	}
+	return nil
+}
+
+// ServeHTTP resolves the service from the path and proxies to it.
+func (g *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := serviceNameFromPath(r.URL.Path)
+
+	g.mu.RLock()
+	entry := g.entries[name]
+	g.mu.RUnlock()
+
+	if entry == nil {
+		writeJSONError(w, http.StatusNotFound, "unknown service")
+		return
+	}
+	entry.handler(w, r)
+}
+
+// serviceNameFromPath extracts <service> from /api/<service>/....
+func serviceNameFromPath(path string) string {
+	const apiPrefix = "/api/"
+	if len(path) <= len(apiPrefix) || path[:len(apiPrefix)] != apiPrefix {
+		return ""
+	}
+	rest := path[len(apiPrefix):]
+	for i := 0; i < len(rest); i++ {
+		if rest[i] == '/' {
+			return rest[:i]
+		}
+	}
+	return rest
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestRegistryRoutesAndRejectsUnknown(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	reg := NewRegistry(testConfig(), nil)
+	reg.Register(testService("agent", backend.URL), newTestBreaker())
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("registered service: got status %d, want 200", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/nope/x", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown service: got status %d, want 404", rec.Code)
+	}
+}
+
+// TestRegistryConcurrentRegistration hammers the registry with proxied
+// requests while a service is registered and unregistered; run with -race.
+func TestRegistryConcurrentRegistration(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	reg := NewRegistry(testConfig(), nil)
+	svc := testService("agent", backend.URL)
+	reg.Register(svc, newTestBreaker())
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				reg.Unregister("agent")
+				reg.Register(svc, newTestBreaker())
+			}
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				rec := httptest.NewRecorder()
+				reg.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/agent/x", nil))
+				if rec.Code != http.StatusOK && rec.Code != http.StatusNotFound {
+					t.Errorf("got status %d, want 200 or 404", rec.Code)
+					return
+				}
+			}
+		}()
+	}
+
+	// Let the proxy goroutines finish, then stop the churn.
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	defer func() { <-done }()
+	defer close(stop)
+}
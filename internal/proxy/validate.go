@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/jsonschema"
+)
+
+// validateRequestBody checks a JSON request body against the service schema,
+// writing a 400 with the violations when it doesn't conform. Non-JSON
+// requests and bodies larger than maxBytes skip validation. The body is
+// buffered and restored so the proxy forwards it intact. It reports whether
+// the request may proceed.
+func validateRequestBody(w http.ResponseWriter, r *http.Request, schema *jsonschema.Schema, maxBytes int64) bool {
+	if r.Body == nil || r.Body == http.NoBody {
+		return true
+	}
+	ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || ct != "application/json" {
+		return true
+	}
+	if r.ContentLength > maxBytes {
+		return true
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "failed to read request body")
+		return false
+	}
+
+	if int64(len(body)) > maxBytes {
+		// Oversized despite a missing Content-Length; skip validation, but
+		// forward the request intact: stitch the read prefix back in front
+		// of the unread remainder, keeping the original body as the closer.
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return true
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "request body is not valid JSON")
+		return false
+	}
+	if violations := schema.Validate(v); len(violations) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":             "request body failed schema validation",
+			"validation_errors": violations,
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleSchema = `{
+	"type": "object",
+	"required": ["prompt"],
+	"properties": {
+		"prompt": {"type": "string", "minLength": 1},
+		"max_tokens": {"type": "integer", "minimum": 1}
+	}
+}`
+
+func writeSchemaFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "llm-schema.json")
+	if err := os.WriteFile(path, []byte(sampleSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSchemaValidationRejectsInvalidBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("invalid body reached the backend")
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.SchemaMaxBodyBytes = 1 << 20
+	svc := testService("llm", backend.URL)
+	svc.RequestSchemaPath = writeSchemaFile(t)
+	handler := ProxyHandler(svc, newTestBreaker(), cfg, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/llm/generate",
+		strings.NewReader(`{"max_tokens": 100}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want 400", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.Contains(string(body), "prompt") {
+		t.Fatalf("validation errors should name the missing field, got %s", body)
+	}
+}
+
+func TestSchemaValidationPassesValidBody(t *testing.T) {
+	var gotBody string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.SchemaMaxBodyBytes = 1 << 20
+	svc := testService("llm", backend.URL)
+	svc.RequestSchemaPath = writeSchemaFile(t)
+	handler := ProxyHandler(svc, newTestBreaker(), cfg, nil)
+
+	payload := `{"prompt": "hello", "max_tokens": 100}`
+	req := httptest.NewRequest(http.MethodPost, "/api/llm/generate", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+	if gotBody != payload {
+		t.Fatalf("backend got body %q, want it forwarded intact", gotBody)
+	}
+}
+
+func TestSchemaValidationSkipsNonJSON(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.SchemaMaxBodyBytes = 1 << 20
+	svc := testService("llm", backend.URL)
+	svc.RequestSchemaPath = writeSchemaFile(t)
+	handler := ProxyHandler(svc, newTestBreaker(), cfg, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/llm/generate", strings.NewReader("plain text"))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200 (non-JSON skips validation)", rec.Code)
+	}
+}
+
+func TestSchemaValidationSkipsNonPOST(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.SchemaMaxBodyBytes = 1 << 20
+	svc := testService("llm", backend.URL)
+	svc.RequestSchemaPath = writeSchemaFile(t)
+	handler := ProxyHandler(svc, newTestBreaker(), cfg, nil)
+
+	// Reads are never held to the request schema, even with a JSON body.
+	req := httptest.NewRequest(http.MethodGet, "/api/llm/models",
+		strings.NewReader(`{"max_tokens": 100}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200 (non-POST skips validation)", rec.Code)
+	}
+}
+
+// chunkedReader hides its length so httptest.NewRequest leaves
+// ContentLength at -1, as a real chunked upload would.
+type chunkedReader struct{ io.Reader }
+
+func TestSchemaValidationForwardsOversizedChunkedBodyIntact(t *testing.T) {
+	var gotLen int
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotLen = len(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig()
+	cfg.SchemaMaxBodyBytes = 64
+	svc := testService("llm", backend.URL)
+	svc.RequestSchemaPath = writeSchemaFile(t)
+	handler := ProxyHandler(svc, newTestBreaker(), cfg, nil)
+
+	// A valid JSON body well past the cap: validation is skipped, but
+	// every byte must still reach the backend.
+	payload := `{"prompt": "` + strings.Repeat("x", 500) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/llm/generate",
+		chunkedReader{strings.NewReader(payload)})
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200 (oversized bodies skip validation)", rec.Code)
+	}
+	if gotLen != len(payload) {
+		t.Fatalf("backend got %d bytes, want all %d", gotLen, len(payload))
+	}
+}
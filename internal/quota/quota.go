@@ -0,0 +1,74 @@
+// Package quota enforces hard per-user usage quotas (for billing), distinct
+// from the short-window rate limiter.
+package quota
+
+import (
+	"sync"
+	"time"
+)
+
+// Store counts requests per key within a quota window. Implementations must
+// be safe for concurrent use; the default is in-memory, with Redis as a
+// later drop-in.
+type Store interface {
+	// Increment bumps and returns the count for key in the window starting
+	// at windowStart.
+	Increment(key string, windowStart time.Time) (int64, error)
+}
+
+// MemoryStore is the default in-process quota store. It keeps counts for
+// the current window only: when a new window begins the old counts can
+// never be read again, so they are dropped rather than accumulating one
+// entry per user/service/window forever.
+type MemoryStore struct {
+	mu     sync.Mutex
+	window int64
+	counts map[string]int64
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counts: make(map[string]int64)}
+}
+
+// Increment implements Store.
+func (m *MemoryStore) Increment(key string, windowStart time.Time) (int64, error) {
+	w := windowStart.UnixNano()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if w != m.window {
+		m.window = w
+		m.counts = make(map[string]int64)
+	}
+	m.counts[key]++
+	return m.counts[key], nil
+}
+
+// Tracker enforces a fixed limit of requests per user per service within
+// each period (e.g. 10,000 llm requests per day).
+type Tracker struct {
+	store  Store
+	limit  int64
+	period time.Duration
+}
+
+// NewTracker returns a tracker backed by store allowing limit requests per
+// period.
+func NewTracker(store Store, limit int64, period time.Duration) *Tracker {
+	return &Tracker{store: store, limit: limit, period: period}
+}
+
+// Allow records one request for the user/service pair and reports whether it
+// is within quota, along with when the current window resets.
+func (t *Tracker) Allow(userID, service string) (bool, time.Time, error) {
+	now := time.Now()
+	windowStart := now.Truncate(t.period)
+	reset := windowStart.Add(t.period)
+
+	n, err := t.store.Increment(userID+"|"+service, windowStart)
+	if err != nil {
+		// Fail open: a broken quota store shouldn't take the gateway down.
+		return true, reset, err
+	}
+	return n <= t.limit, reset, nil
+}
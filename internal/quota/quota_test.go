@@ -0,0 +1,29 @@
+package quota
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreDropsPastWindows(t *testing.T) {
+	store := NewMemoryStore()
+	window := time.Now().Truncate(time.Hour)
+
+	store.Increment("user-1|llm", window)
+	store.Increment("user-2|llm", window)
+	if n, _ := store.Increment("user-1|llm", window); n != 2 {
+		t.Fatalf("count = %d, want 2 within one window", n)
+	}
+
+	// A new window starts counting from scratch and releases the old one.
+	next := window.Add(time.Hour)
+	if n, _ := store.Increment("user-1|llm", next); n != 1 {
+		t.Fatalf("count = %d, want 1 in a fresh window", n)
+	}
+	store.mu.Lock()
+	entries := len(store.counts)
+	store.mu.Unlock()
+	if entries != 1 {
+		t.Fatalf("store holds %d entries, want only the current window's", entries)
+	}
+}
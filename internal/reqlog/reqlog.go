@@ -0,0 +1,24 @@
+// Package reqlog writes request-scoped log lines. Every line carries the
+// request ID and service name as structured prefix fields, so the several
+// lines one request can produce (breaker rejection, proxy error, disconnect)
+// all correlate with its access-log entry.
+package reqlog
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/middleware"
+)
+
+// Printf logs a line for the given request and service. The request ID is
+// pulled from the request context; "-" stands in when no ID was assigned
+// (e.g. a handler invoked outside the logging middleware).
+func Printf(r *http.Request, service, format string, args ...interface{}) {
+	id := middleware.GetRequestID(r)
+	if id == "" {
+		id = "-"
+	}
+	log.Printf("request_id=%s service=%s %s", id, service, fmt.Sprintf(format, args...))
+}
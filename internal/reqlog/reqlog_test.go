@@ -0,0 +1,45 @@
+package reqlog
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/middleware"
+)
+
+func TestPrintfIncludesRequestIDAndService(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	req := httptest.NewRequest("GET", "/api/agent/x", nil)
+	req = req.WithContext(middleware.WithRequestID(context.Background(), "req-777"))
+	Printf(req, "agent", "upstream refused: %v", "connection refused")
+
+	line := buf.String()
+	if !strings.Contains(line, "request_id=req-777") {
+		t.Errorf("log line %q missing request_id field", line)
+	}
+	if !strings.Contains(line, "service=agent") {
+		t.Errorf("log line %q missing service field", line)
+	}
+	if !strings.Contains(line, "upstream refused: connection refused") {
+		t.Errorf("log line %q missing the message", line)
+	}
+}
+
+func TestPrintfWithoutIDUsesPlaceholder(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	Printf(httptest.NewRequest("GET", "/x", nil), "rag", "probe failed")
+	if !strings.Contains(buf.String(), "request_id=- service=rag") {
+		t.Errorf("log line %q missing placeholder ID", buf.String())
+	}
+}
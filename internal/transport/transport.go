@@ -0,0 +1,32 @@
+// Package transport builds the shared HTTP transport used for all upstream
+// traffic, so the proxy and health checks pool connections together.
+package transport
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+)
+
+// New constructs the gateway's upstream transport from config. A single
+// instance is shared by the reverse proxies and the health-check client so
+// connection pools are reused rather than churned per call.
+func New(cfg *config.Config) *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		// A custom DialContext turns HTTP/2 off unless it is forced back
+		// on; https upstreams that speak it (native gRPC backends behind
+		// the gRPC-Web translation) need it.
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
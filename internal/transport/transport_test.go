@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/breaker"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/config"
+	"github.com/TwoKai-LTD/xynenyx-gateway/internal/proxy"
+)
+
+func TestNewAppliesPoolSettings(t *testing.T) {
+	cfg := &config.Config{
+		MaxIdleConns:        42,
+		MaxIdleConnsPerHost: 7,
+		IdleConnTimeout:     time.Minute,
+	}
+	tr := New(cfg)
+	if tr.MaxIdleConns != 42 || tr.MaxIdleConnsPerHost != 7 || tr.IdleConnTimeout != time.Minute {
+		t.Fatalf("transport settings not applied: %+v", tr)
+	}
+	if !tr.ForceAttemptHTTP2 {
+		t.Fatal("ForceAttemptHTTP2 must be set: the custom dialer disables HTTP/2 otherwise")
+	}
+}
+
+func TestProxyReusesConnections(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		RequestTimeout:      5 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     time.Minute,
+	}
+
+	var dials atomic.Int64
+	tr := New(cfg)
+	base := tr.DialContext
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials.Add(1)
+		return base(ctx, network, addr)
+	}
+
+	svc := &config.ServiceConfig{Name: "agent", URL: backend.URL}
+	handler := proxy.ProxyHandler(svc, breaker.New(5, time.Second), cfg, tr)
+	gw := httptest.NewServer(handler)
+	defer gw.Close()
+
+	for i := 0; i < 5; i++ {
+		resp, err := http.Get(gw.URL + "/api/agent/ping")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if n := dials.Load(); n != 1 {
+		t.Fatalf("got %d dials for 5 sequential requests, want 1 (pooled)", n)
+	}
+}
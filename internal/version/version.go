@@ -0,0 +1,39 @@
+// Package version carries the build identity stamped in at link time:
+//
+//	go build -ldflags "-X .../internal/version.Version=v1.4.0 \
+//	    -X .../internal/version.Commit=$(git rev-parse --short HEAD) \
+//	    -X .../internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Unstamped builds report "dev".
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+)
+
+// Set via -ldflags at build time.
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// String returns the one-line form used in the startup log.
+func String() string {
+	return Version + " (" + Commit + ")"
+}
+
+// Handler serves the build identity as JSON for deployment verification.
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"version":    Version,
+			"commit":     Commit,
+			"build_time": BuildTime,
+			"go_version": runtime.Version(),
+		})
+	}
+}
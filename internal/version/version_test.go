@@ -0,0 +1,37 @@
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestHandlerReportsInjectedValues(t *testing.T) {
+	origVersion, origCommit, origBuildTime := Version, Commit, BuildTime
+	defer func() { Version, Commit, BuildTime = origVersion, origCommit, origBuildTime }()
+	Version, Commit, BuildTime = "v1.4.0", "abc1234", "2026-08-28T00:00:00Z"
+
+	rec := httptest.NewRecorder()
+	Handler()(rec, httptest.NewRequest(http.MethodGet, "/gateway/version", nil))
+
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	want := map[string]string{
+		"version":    "v1.4.0",
+		"commit":     "abc1234",
+		"build_time": "2026-08-28T00:00:00Z",
+		"go_version": runtime.Version(),
+	}
+	for k, v := range want {
+		if body[k] != v {
+			t.Errorf("%s = %q, want %q", k, body[k], v)
+		}
+	}
+	if got := String(); got != "v1.4.0 (abc1234)" {
+		t.Errorf("String = %q, want the version and commit", got)
+	}
+}